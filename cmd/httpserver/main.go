@@ -1,27 +1,124 @@
 package main
 
 import (
+	"crypto/tls"
+	"flag"
 	"fmt"
 	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
 	"httpfromtcp/internal/server"
+	"httpfromtcp/internal/websocket"
 	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 const port = 42069
 
+var (
+	assets  *server.FileServer
+	httpbin *server.ReverseProxy
+)
+
 func main() {
-	srv, err := server.Serve(port, Handler)
+	addr := flag.String("addr", fmt.Sprintf(":%d", port), "address to listen on, e.g. 127.0.0.1:8080 or unix:/run/app.sock")
+	logFormat := flag.String("log-format", server.LOG_FORMAT_COMMON, "access log format: common, combined, json or none")
+	metricsPath := flag.String("metrics-path", "/metrics", "path serving Prometheus metrics, empty to disable")
+	tlsCerts := flag.String("tls-cert", "", "comma separated certificate files, enables TLS")
+	tlsKeys := flag.String("tls-key", "", "comma separated key files matching -tls-cert")
+	maxConns := flag.Int("max-conns", 0, "maximum concurrent connections, 0 for unlimited")
+	rejectWhenFull := flag.Bool("reject-when-full", false, "answer 503 instead of waiting when -max-conns is reached")
+	maxConnsPerIP := flag.Int("max-conns-per-ip", 0, "maximum concurrent connections per client IP, 0 for unlimited")
+	httpbinRate := flag.Float64("httpbin-rate", 5, "requests per second per client IP allowed on /httpbin, 0 for unlimited")
+	httpbinBurst := flag.Int("httpbin-burst", 10, "requests a client IP may send at once on /httpbin")
+	httpbinUpstream := flag.String("httpbin-upstream", "https://httpbin.org", "upstream the /httpbin/ path is proxied to")
+	assetsDir := flag.String("assets", "assets", "directory served under /assets/")
+	listAssets := flag.Bool("list-assets", false, "render directory listings under /assets/")
+	etags := flag.Bool("etags", true, "send ETags and answer conditional requests for buffered responses")
+	compressMinSize := flag.Int("compress-min-size", server.DEFAULT_COMPRESSION_MIN_SIZE, "smallest response compressed with gzip or deflate, negative to disable")
+	maxDecodedBody := flag.Int64("max-decoded-body", request.DEFAULT_MAX_DECODED_BODY_SIZE, "largest gzip or deflate request body after decoding, 0 to pass bodies through undecoded")
+	flag.Parse()
+
+	assets = server.NewFileServer(os.DirFS(*assetsDir), "/assets/")
+	assets.ListDirectories = *listAssets
+
+	var err error
+	httpbin, err = server.NewReverseProxy(*httpbinUpstream, "/httpbin")
+	if err != nil {
+		log.Fatalf("Error creating the httpbin proxy: %v", err)
+	}
+
+	var options []server.Option
+	if *logFormat != "none" {
+		accessLogger, err := server.NewAccessLogger(os.Stdout, *logFormat)
+		if err != nil {
+			log.Fatalf("Error creating access logger: %v", err)
+		}
+		options = append(options, server.WithAccessLogger(accessLogger))
+	}
+
+	if *metricsPath != "" {
+		options = append(options, server.WithMetrics(server.NewMetrics(), *metricsPath))
+	}
+
+	if *etags {
+		options = append(options, server.WithETags())
+	}
+
+	if *compressMinSize >= 0 {
+		options = append(options, server.WithCompression(*compressMinSize))
+	}
+
+	if *maxDecodedBody > 0 {
+		options = append(options, server.WithRequestDecoding(*maxDecodedBody))
+	}
+
+	if *maxConns > 0 {
+		mode := server.CONNECTION_LIMIT_BLOCK
+		if *rejectWhenFull {
+			mode = server.CONNECTION_LIMIT_REJECT
+		}
+		options = append(options, server.WithMaxConnections(*maxConns, mode))
+	}
+
+	if *maxConnsPerIP > 0 {
+		options = append(options, server.WithMaxConnectionsPerIP(*maxConnsPerIP))
+	}
+
+	listener, err := server.Listen(*addr)
+	if err != nil {
+		log.Fatalf("Error listening on %s: %v", *addr, err)
+	}
+
+	if *tlsCerts != "" {
+		store, err := loadCertificates(*tlsCerts, *tlsKeys)
+		if err != nil {
+			log.Fatalf("Error loading certificates: %v", err)
+		}
+		listener = tls.NewListener(listener, store.Config())
+		options = append(options, server.WithCertificateReload(store))
+	}
+
+	handler := server.Handler(newRouter().Serve)
+	if *httpbinRate > 0 {
+		limiter, err := server.NewRateLimiter(*httpbinRate, *httpbinBurst, httpbinKey)
+		if err != nil {
+			log.Fatalf("Error creating the rate limiter: %v", err)
+		}
+		handler = limiter.Middleware(handler)
+	}
+
+	srv, err := server.ServeListener(listener, handler, options...)
 	if err != nil {
 		log.Fatalf("Error starting srv: %v", err)
 	}
 	defer srv.Close()
-	log.Println("Server started on port", port)
+	log.Println("Server started on", srv.Addr())
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -29,63 +126,107 @@ func main() {
 	log.Println("Server gracefully stopped")
 }
 
-func Handler(w io.Writer, req *request.Request) *server.HandlerError {
-	requestPath := req.RequestLine.RequestTarget
+func loadCertificates(certFiles, keyFiles string) (*server.CertificateStore, error) {
+	certs := strings.Split(certFiles, ",")
+	keys := strings.Split(keyFiles, ",")
+	if len(certs) != len(keys) {
+		return nil, fmt.Errorf("error: got %d certificates and %d keys", len(certs), len(keys))
+	}
 
-	switch requestPath {
-	case "/yourproblem":
-		return &server.HandlerError{
-			StatusCode: 400,
-			Message:    []byte("Your problem is not my problem"),
-		}
-	case "/myproblem":
-		return &server.HandlerError{
-			StatusCode: 500,
-			Message:    []byte("Woopsie, my bad"),
-		}
-	case "/video":
-		file, err := os.ReadFile("assets/vim.mp4")
+	files := make([]server.CertificateFiles, len(certs))
+	for i := range certs {
+		files[i] = server.CertificateFiles{CertFile: certs[i], KeyFile: keys[i]}
+	}
+
+	return server.NewCertificateStore(files...)
+}
+
+// httpbinKey only rate limits the requests proxied to httpbin.org
+func httpbinKey(req *request.Request) string {
+	if !strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin") {
+		return ""
+	}
+
+	return server.KeyByRemoteIP(req)
+}
+
+func newRouter() *server.Router {
+	router := server.NewRouter()
+	router.Handle("/yourproblem", yourProblemHandler, "GET")
+	router.Handle("/myproblem", myProblemHandler, "GET")
+	router.Handle("/video", videoHandler, "GET")
+	router.Handle(assets.Prefix, assets.Handle, "GET")
+	router.Handle("/httpbin/", httpbin.Handle, "GET", "POST", "PUT", "PATCH", "DELETE")
+	router.Handle("/ws/echo", echoWebSocketHandler, "GET")
+	router.Handle("/events/clock", clockEventsHandler, "GET")
+	router.Handle("/", allGoodHandler, "GET", "POST")
+
+	return router
+}
+
+func yourProblemHandler(w io.Writer, req *request.Request) *server.HandlerError {
+	return &server.HandlerError{
+		StatusCode: 400,
+		Message:    []byte("Your problem is not my problem"),
+	}
+}
+
+func myProblemHandler(w io.Writer, req *request.Request) *server.HandlerError {
+	return &server.HandlerError{
+		StatusCode: 500,
+		Message:    []byte("Woopsie, my bad"),
+	}
+}
+
+func videoHandler(w io.Writer, req *request.Request) *server.HandlerError {
+	return assets.ServeFile(w, req, "vim.mp4")
+}
+
+// echoWebSocketHandler sends every websocket message back to the client
+func echoWebSocketHandler(w io.Writer, req *request.Request) *server.HandlerError {
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	conn, herr := upgrader.Upgrade(w, req)
+	if herr != nil {
+		return herr
+	}
+	defer conn.Close()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
 		if err != nil {
-			fmt.Printf("Error: %s", err.Error())
-			return &server.HandlerError{
-				StatusCode: 500,
-				Message:    []byte("Woopsie, my bad"),
-			}
+			return nil
 		}
+		if err := conn.WriteMessage(messageType, data); err != nil {
+			return nil
+		}
+	}
+}
 
-		w.Write(file)
-	default:
-		substr := "/httpbin"
-		httpBinPrefixIndex := strings.Index(requestPath, substr)
-		if httpBinPrefixIndex != -1 {
-			trimPath := requestPath[httpBinPrefixIndex+len(substr):]
-
-			getResponse, err := http.Get(fmt.Sprintf("https://httpbin.org/%s", trimPath))
-			if err != nil {
-				return &server.HandlerError{
-					StatusCode: 500,
-					Message:    []byte("Error at getting httpbin"),
-				}
-			}
-
-			bufferSize := 1024
-			for {
-				dataBuffer := make([]byte, bufferSize)
-				n, err := getResponse.Body.Read(dataBuffer)
-				if err != nil {
-					break
-				}
+// clockEventsHandler pushes the server time every second as server-sent events
+func clockEventsHandler(w io.Writer, req *request.Request) *server.HandlerError {
+	stream, herr := server.NewEventStream(w, req, server.DEFAULT_KEEP_ALIVE_INTERVAL)
+	if herr != nil {
+		return herr
+	}
+	defer stream.Close()
 
-				fmt.Printf("Read size: %d\n", n)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 
-				w.Write(dataBuffer[:bufferSize])
+	for {
+		select {
+		case <-stream.Done():
+			return nil
+		case now := <-ticker.C:
+			event := response.Event{ID: strconv.FormatInt(now.Unix(), 10), Event: "clock", Data: now.Format(time.RFC3339)}
+			if err := stream.Send(event); err != nil {
+				return nil
 			}
-			w.Write([]byte("\r\n"))
-			break
 		}
-
-		w.Write([]byte("All good, frfr"))
 	}
+}
 
+func allGoodHandler(w io.Writer, req *request.Request) *server.HandlerError {
+	w.Write([]byte("All good, frfr"))
 	return nil
 }
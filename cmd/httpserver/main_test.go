@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"testing/fstest"
+
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"httpfromtcp/internal/servertest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutes(t *testing.T) {
+	upstream, err := servertest.NewTCPServer(func(w io.Writer, req *request.Request) *server.HandlerError {
+		w.(*server.ResponseWriter).Header().Set("x-upstream-target", req.RequestLine.RequestTarget)
+		w.Write([]byte("from upstream"))
+		return nil
+	})
+	require.NoError(t, err)
+	defer upstream.Close()
+
+	assets = server.NewFileServer(fstest.MapFS{"style.css": {Data: []byte("body {}")}}, "/assets/")
+	httpbin, err = server.NewReverseProxy(upstream.URL(), "/httpbin")
+	require.NoError(t, err)
+	handler := newRouter().Serve
+
+	// Test: Fixed responses
+	for target, statusCode := range map[string]response.StatusCode{
+		"/":            response.OK,
+		"/yourproblem": response.BAD_REQUEST,
+		"/myproblem":   response.INTERNAL_SERVER_ERROR,
+	} {
+		recorder, err := servertest.Record(handler, servertest.NewRequest("GET", target, nil))
+		require.NoError(t, err)
+		assert.Equal(t, statusCode, recorder.StatusCode, target)
+	}
+
+	// Test: Methods not routed
+	recorder, err := servertest.Record(handler, servertest.NewRequest("DELETE", "/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(response.METHOD_NOT_ALLOWED), recorder.StatusCode)
+
+	// Test: Assets
+	recorder, err = servertest.Record(handler, servertest.NewRequest("GET", "/assets/style.css", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "body {}", string(recorder.Body))
+
+	// Test: httpbin is proxied
+	srv := servertest.NewServer(handler)
+	defer srv.Close()
+	recorder, err = srv.Send("GET /httpbin/get?x=1 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(response.OK), recorder.StatusCode)
+	assert.Equal(t, "/get?x=1", recorder.Headers.Get("x-upstream-target"))
+	assert.Contains(t, string(recorder.Body), "from upstream")
+}
@@ -0,0 +1,400 @@
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+const (
+	DEFAULT_DIAL_TIMEOUT            = 10 * time.Second
+	DEFAULT_IDLE_TIMEOUT            = 90 * time.Second
+	DEFAULT_MAX_IDLE_CONNS_PER_HOST = 2
+	DEFAULT_MAX_REDIRECTS           = 10
+	DEFAULT_USER_AGENT              = "httpfromtcp"
+
+	// maxBodyDrain is how much of an unread body Close reads to keep the connection reusable
+	maxBodyDrain = 4 * 1024
+)
+
+var (
+	ERROR_UNSUPPORTED_SCHEME = fmt.Errorf("error: only http and https URLs are supported")
+	ERROR_TOO_MANY_REDIRECTS = fmt.Errorf("error: stopped after too many redirects")
+
+	// idempotentMethods can be sent again when it is unknown whether the server processed them,
+	// see RFC 9110 section 9.2.2
+	idempotentMethods = map[string]bool{
+		"GET":     true,
+		"HEAD":    true,
+		"OPTIONS": true,
+		"TRACE":   true,
+		"PUT":     true,
+		"DELETE":  true,
+	}
+)
+
+// Request is an outgoing request, Host, User-Agent and Content-Length are filled in when missing
+type Request struct {
+	Method  string
+	URL     *url.URL
+	Headers headers.Headers
+	Body    []byte
+}
+
+// Client sends requests over pooled connections, it is safe for concurrent use
+type Client struct {
+	// Timeout limits a whole exchange, redirects and reading the body included, 0 for none
+	Timeout               time.Duration
+	DialTimeout           time.Duration
+	ResponseHeaderTimeout time.Duration
+	// IdleTimeout is how long an unused connection stays in the pool
+	IdleTimeout         time.Duration
+	MaxIdleConnsPerHost int
+	// MaxRedirects is the number of redirects followed, 0 returns redirect responses as they are
+	MaxRedirects int
+	TLSConfig    *tls.Config
+
+	mutex sync.Mutex
+	idle  map[string][]*pooledConn
+}
+
+type pooledConn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	key       string
+	idleSince time.Time
+}
+
+func NewRequest(method, rawURL string, body []byte) (*Request, error) {
+	requestURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (requestURL.Scheme != "http" && requestURL.Scheme != "https") || requestURL.Host == "" {
+		return nil, ERROR_UNSUPPORTED_SCHEME
+	}
+
+	return &Request{
+		Method:  method,
+		URL:     requestURL,
+		Headers: headers.Headers{},
+		Body:    body,
+	}, nil
+}
+
+func NewClient() *Client {
+	return &Client{
+		DialTimeout:         DEFAULT_DIAL_TIMEOUT,
+		IdleTimeout:         DEFAULT_IDLE_TIMEOUT,
+		MaxIdleConnsPerHost: DEFAULT_MAX_IDLE_CONNS_PER_HOST,
+		MaxRedirects:        DEFAULT_MAX_REDIRECTS,
+		idle:                map[string][]*pooledConn{},
+	}
+}
+
+func (c *Client) Get(rawURL string) (*Response, error) {
+	req, err := NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(req)
+}
+
+func (c *Client) Post(rawURL, contentType string, body []byte) (*Response, error) {
+	req, err := NewRequest("POST", rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Headers.Set("content-type", contentType)
+
+	return c.Do(req)
+}
+
+// Do sends req and follows redirects, the caller has to close the body of the returned response
+func (c *Client) Do(req *Request) (*Response, error) {
+	deadline := time.Time{}
+	if c.Timeout > 0 {
+		deadline = time.Now().Add(c.Timeout)
+	}
+
+	for redirects := 0; ; redirects++ {
+		resp, err := c.send(req, deadline)
+		if err != nil {
+			return nil, err
+		}
+
+		location := resp.Headers.Get("location")
+		if !isRedirect(resp.StatusCode) || location == "" || c.MaxRedirects == 0 {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if redirects >= c.MaxRedirects {
+			return nil, ERROR_TOO_MANY_REDIRECTS
+		}
+
+		req, err = redirectRequest(req, resp.StatusCode, location)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// CloseIdleConnections closes the pooled connections, the ones in use are not affected
+func (c *Client) CloseIdleConnections() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, conns := range c.idle {
+		for _, pc := range conns {
+			pc.conn.Close()
+		}
+		delete(c.idle, key)
+	}
+}
+
+// send performs a single exchange, retrying idempotent requests once on a fresh connection when
+// a pooled one turns out to have been closed by the server in the meantime
+func (c *Client) send(req *Request, deadline time.Time) (*Response, error) {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, ERROR_UNSUPPORTED_SCHEME
+	}
+	key := req.URL.Scheme + "://" + hostPort(req.URL)
+
+	for attempt := 0; ; attempt++ {
+		pc, reused, err := c.getConn(key, req.URL, deadline)
+		if err != nil {
+			return nil, err
+		}
+
+		headerDeadline := deadline
+		if c.ResponseHeaderTimeout > 0 {
+			limit := time.Now().Add(c.ResponseHeaderTimeout)
+			if headerDeadline.IsZero() || limit.Before(headerDeadline) {
+				headerDeadline = limit
+			}
+		}
+		pc.conn.SetDeadline(headerDeadline)
+
+		var resp *Response
+		err = req.wireRequest().Write(pc.conn)
+		if err == nil {
+			resp, err = readResponse(pc.reader, req.Method)
+		}
+		if err != nil {
+			pc.conn.Close()
+			if reused && attempt == 0 && isStaleConnection(err) && idempotentMethods[req.Method] {
+				continue
+			}
+			return nil, err
+		}
+
+		pc.conn.SetDeadline(deadline)
+		resp.Request = req
+		resp.Body = &bodyReader{
+			client:   c,
+			pc:       pc,
+			reader:   resp.Body,
+			reusable: resp.keepAlive && !req.Headers.HasToken("connection", "close"),
+		}
+
+		return resp, nil
+	}
+}
+
+func (c *Client) getConn(key string, target *url.URL, deadline time.Time) (*pooledConn, bool, error) {
+	c.mutex.Lock()
+	for len(c.idle[key]) > 0 {
+		conns := c.idle[key]
+		pc := conns[len(conns)-1]
+		c.idle[key] = conns[:len(conns)-1]
+		if c.IdleTimeout > 0 && time.Since(pc.idleSince) > c.IdleTimeout {
+			pc.conn.Close()
+			continue
+		}
+		c.mutex.Unlock()
+		return pc, true, nil
+	}
+	c.mutex.Unlock()
+
+	dialer := &net.Dialer{Timeout: c.DialTimeout, Deadline: deadline}
+	conn, err := dialer.Dial("tcp", hostPort(target))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if target.Scheme == "https" {
+		config := &tls.Config{}
+		if c.TLSConfig != nil {
+			config = c.TLSConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = target.Hostname()
+		}
+		tlsConn := tls.Client(conn, config)
+		if c.DialTimeout > 0 {
+			tlsConn.SetDeadline(time.Now().Add(c.DialTimeout))
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, false, err
+		}
+		conn = tlsConn
+	}
+
+	return &pooledConn{conn: conn, reader: bufio.NewReader(conn), key: key}, false, nil
+}
+
+func (c *Client) putConn(pc *pooledConn) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.idle == nil {
+		c.idle = map[string][]*pooledConn{}
+	}
+	if len(c.idle[pc.key]) >= c.MaxIdleConnsPerHost {
+		pc.conn.Close()
+		return
+	}
+
+	pc.conn.SetDeadline(time.Time{})
+	pc.idleSince = time.Now()
+	c.idle[pc.key] = append(c.idle[pc.key], pc)
+}
+
+// bodyReader returns the connection to the pool once the body was read to the end and closed
+type bodyReader struct {
+	client   *Client
+	pc       *pooledConn
+	reader   io.Reader
+	reusable bool
+	eof      bool
+	closed   bool
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	n, err := b.reader.Read(p)
+	if err == io.EOF {
+		b.eof = true
+	}
+
+	return n, err
+}
+
+func (b *bodyReader) Close() error {
+	if b.closed {
+		return nil
+	}
+	if !b.eof && b.reusable {
+		io.CopyN(io.Discard, b, maxBodyDrain)
+	}
+	b.closed = true
+
+	if b.eof && b.reusable {
+		b.client.putConn(b.pc)
+		return nil
+	}
+
+	return b.pc.conn.Close()
+}
+
+// wireRequest fills in the headers a request is sent with, a body is framed by Content-Length
+func (r *Request) wireRequest() *request.Request {
+	requestHeaders := headers.Headers{}
+	for name, value := range r.Headers {
+		requestHeaders.Set(name, value)
+	}
+	if requestHeaders.Get("host") == "" {
+		requestHeaders.Set("host", r.URL.Host)
+	}
+	if requestHeaders.Get("user-agent") == "" {
+		requestHeaders.Set("user-agent", DEFAULT_USER_AGENT)
+	}
+	requestHeaders.Delete("transfer-encoding")
+	if r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH" {
+		requestHeaders.Set("content-length", strconv.Itoa(len(r.Body)))
+	}
+
+	return &request.Request{
+		RequestLine: request.RequestLine{Method: r.Method, RequestTarget: r.URL.RequestURI(), HttpVersion: "1.1"},
+		Headers:     requestHeaders,
+		Body:        r.Body,
+	}
+}
+
+func isRedirect(statusCode response.StatusCode) bool {
+	switch statusCode {
+	case response.MOVED_PERMANENTLY, response.FOUND, response.SEE_OTHER, response.TEMPORARY_REDIRECT, response.PERMANENT_REDIRECT:
+		return true
+	default:
+		return false
+	}
+}
+
+// redirectRequest builds the request following a redirect. 303 and, like browsers do, POSTs
+// answered with 301 or 302 turn into a GET without body, 307 and 308 resend the request as is.
+func redirectRequest(req *Request, statusCode response.StatusCode, location string) (*Request, error) {
+	target, err := req.URL.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	next := &Request{
+		Method:  req.Method,
+		URL:     target,
+		Headers: headers.Headers{},
+		Body:    req.Body,
+	}
+	for name, value := range req.Headers {
+		next.Headers.Set(name, value)
+	}
+	next.Headers.Delete("host")
+
+	if (statusCode == response.SEE_OTHER && req.Method != "HEAD") ||
+		((statusCode == response.MOVED_PERMANENTLY || statusCode == response.FOUND) && req.Method == "POST") {
+		next.Method = "GET"
+		next.Body = nil
+		next.Headers.Delete("content-type")
+		next.Headers.Delete("content-length")
+	}
+	if !strings.EqualFold(target.Host, req.URL.Host) {
+		next.Headers.Delete("authorization")
+		next.Headers.Delete("cookie")
+	}
+
+	return next, nil
+}
+
+// isStaleConnection reports whether err means the server closed a pooled connection, the
+// request may or may not have been processed before
+func isStaleConnection(err error) bool {
+	return err == io.EOF || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+func hostPort(target *url.URL) string {
+	if target.Port() != "" {
+		return target.Host
+	}
+	if target.Scheme == "https" {
+		return net.JoinHostPort(target.Hostname(), "443")
+	}
+
+	return net.JoinHostPort(target.Hostname(), "80")
+}
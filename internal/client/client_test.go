@@ -0,0 +1,257 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubServer answers the requests of every connection with respond, closing the connection after
+// a response unless respond keeps it alive. It counts the connections it accepted.
+type stubServer struct {
+	listener    net.Listener
+	connections atomic.Int64
+}
+
+func newStubServer(t *testing.T, respond func(head, body string) (string, bool)) *stubServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	stub := &stubServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			stub.connections.Add(1)
+			go stub.serve(conn, respond)
+		}
+	}()
+
+	return stub
+}
+
+func (s *stubServer) serve(conn net.Conn, respond func(head, body string) (string, bool)) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		head := ""
+		for !strings.HasSuffix(head, "\r\n\r\n") {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			head += line
+		}
+
+		body := make([]byte, 0)
+		for _, line := range strings.Split(head, "\r\n") {
+			if name, value, ok := strings.Cut(line, ": "); ok && name == "content-length" {
+				length, _ := strconv.Atoi(value)
+				body = make([]byte, length)
+				io.ReadFull(reader, body)
+			}
+		}
+
+		raw, keepAlive := respond(head, string(body))
+		conn.Write([]byte(raw))
+		if !keepAlive {
+			return
+		}
+	}
+}
+
+func (s *stubServer) url(path string) string {
+	return "http://" + s.listener.Addr().String() + path
+}
+
+func readBody(t *testing.T, resp *Response) string {
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	return string(body)
+}
+
+func TestClientFraming(t *testing.T) {
+	var lastHead string
+	stub := newStubServer(t, func(head, body string) (string, bool) {
+		lastHead = head
+		switch {
+		case strings.HasPrefix(head, "GET /length"):
+			return "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", true
+		case strings.HasPrefix(head, "GET /chunked"):
+			return "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Sum\r\n\r\n" +
+				"5\r\nhello\r\n7;name=value\r\n, world\r\n0\r\nX-Sum: 12\r\n\r\n", true
+		case strings.HasPrefix(head, "POST /echo"):
+			return "HTTP/1.1 201 Created\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body, true
+		case strings.HasPrefix(head, "HEAD"):
+			return "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n", true
+		default:
+			return "HTTP/1.1 200 OK\r\n\r\nuntil the end", false
+		}
+	})
+	client := NewClient()
+
+	// Test: Content-Length body and the serialised request
+	resp, err := client.Get(stub.url("/length?x=1"))
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(200), resp.StatusCode)
+	assert.Equal(t, "OK", resp.Reason)
+	assert.Equal(t, int64(5), resp.ContentLength)
+	assert.Equal(t, "hello", readBody(t, resp))
+	assert.True(t, strings.HasPrefix(lastHead, "GET /length?x=1 HTTP/1.1\r\n"))
+	assert.Contains(t, lastHead, "host: "+stub.listener.Addr().String()+"\r\n")
+	assert.Contains(t, lastHead, "user-agent: "+DEFAULT_USER_AGENT+"\r\n")
+
+	// Test: Chunked body with extensions and trailers, on the pooled connection
+	resp, err = client.Get(stub.url("/chunked"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", readBody(t, resp))
+	assert.Equal(t, "12", resp.Trailers.Get("x-sum"))
+
+	// Test: Request body
+	resp, err = client.Post(stub.url("/echo"), "text/plain", []byte("ping"))
+	require.NoError(t, err)
+	assert.Equal(t, response.CREATED, int(resp.StatusCode))
+	assert.Equal(t, "ping", readBody(t, resp))
+	assert.Contains(t, lastHead, "content-type: text/plain\r\n")
+
+	// Test: HEAD responses have no body whatever their Content-Length
+	req, err := NewRequest("HEAD", stub.url("/"), nil)
+	require.NoError(t, err)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "", readBody(t, resp))
+	assert.Equal(t, int64(1), stub.connections.Load())
+
+	// Test: Close-delimited body, the connection can not be reused
+	resp, err = client.Get(stub.url("/close"))
+	require.NoError(t, err)
+	assert.Equal(t, "until the end", readBody(t, resp))
+	resp, err = client.Get(stub.url("/length"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", readBody(t, resp))
+	assert.Equal(t, int64(2), stub.connections.Load())
+
+	// Test: Only http and https
+	_, err = client.Get("ftp://example.com/file")
+	assert.ErrorIs(t, err, ERROR_UNSUPPORTED_SCHEME)
+}
+
+func TestClientRedirects(t *testing.T) {
+	var lastHead, lastBody string
+	stub := newStubServer(t, func(head, body string) (string, bool) {
+		lastHead, lastBody = head, body
+		target := strings.Fields(head)[1]
+		switch target {
+		case "/found":
+			return "HTTP/1.1 302 Found\r\nLocation: /final\r\nContent-Length: 3\r\n\r\nbye", true
+		case "/see-other":
+			return "HTTP/1.1 303 See Other\r\nLocation: final\r\nContent-Length: 0\r\n\r\n", true
+		case "/temporary":
+			return "HTTP/1.1 307 Temporary Redirect\r\nLocation: /final?kept=1\r\nContent-Length: 0\r\n\r\n", true
+		case "/loop":
+			return "HTTP/1.1 301 Moved Permanently\r\nLocation: /loop\r\nContent-Length: 0\r\n\r\n", true
+		default:
+			return "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nfinal", true
+		}
+	})
+	client := NewClient()
+
+	// Test: Relative locations are followed
+	resp, err := client.Get(stub.url("/found"))
+	require.NoError(t, err)
+	assert.Equal(t, "final", readBody(t, resp))
+	assert.Equal(t, "/final", resp.Request.URL.Path)
+
+	// Test: 303 turns a POST into a GET without body
+	resp, err = client.Post(stub.url("/see-other"), "text/plain", []byte("data"))
+	require.NoError(t, err)
+	readBody(t, resp)
+	assert.True(t, strings.HasPrefix(lastHead, "GET /final HTTP/1.1\r\n"), lastHead)
+	assert.NotContains(t, lastHead, "content-type")
+
+	// Test: 307 resends the method and body
+	resp, err = client.Post(stub.url("/temporary"), "text/plain", []byte("data"))
+	require.NoError(t, err)
+	readBody(t, resp)
+	assert.True(t, strings.HasPrefix(lastHead, "POST /final?kept=1 HTTP/1.1\r\n"), lastHead)
+	assert.Equal(t, "data", lastBody)
+
+	// Test: Redirect loops give up
+	_, err = client.Get(stub.url("/loop"))
+	assert.ErrorIs(t, err, ERROR_TOO_MANY_REDIRECTS)
+
+	// Test: Redirects can be left to the caller
+	client.MaxRedirects = 0
+	resp, err = client.Get(stub.url("/found"))
+	require.NoError(t, err)
+	assert.Equal(t, response.FOUND, int(resp.StatusCode))
+	assert.Equal(t, "bye", readBody(t, resp))
+}
+
+func TestClientConnections(t *testing.T) {
+	requests := atomic.Int64{}
+	stub := newStubServer(t, func(head, body string) (string, bool) {
+		if strings.HasPrefix(head, "GET /slow") {
+			time.Sleep(200 * time.Millisecond)
+		}
+		// every other response closes the connection without saying so
+		return "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok", requests.Add(1)%2 == 1
+	})
+
+	// Test: A pooled connection the server closed is replaced transparently
+	client := NewClient()
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(stub.url("/"))
+		require.NoError(t, err)
+		assert.Equal(t, "ok", readBody(t, resp))
+	}
+
+	// Test: Requests that are not idempotent are not sent again on a fresh connection
+	closing := newStubServer(t, func(head, body string) (string, bool) {
+		return "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok", false
+	})
+	resp, err := client.Get(closing.url("/"))
+	require.NoError(t, err)
+	assert.Equal(t, "ok", readBody(t, resp))
+	_, err = client.Post(closing.url("/"), "text/plain", []byte("once"))
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), closing.connections.Load())
+
+	// Test: Response header timeout
+	client.ResponseHeaderTimeout = 50 * time.Millisecond
+	_, err = client.Get(stub.url("/slow"))
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+	client.CloseIdleConnections()
+
+	// Test: Responses of this project's server
+	srv, err := server.ServeAddress("127.0.0.1:0", func(w io.Writer, req *request.Request) *server.HandlerError {
+		w.Write([]byte("served"))
+		return nil
+	})
+	require.NoError(t, err)
+	defer srv.Close()
+	resp, err = client.Get((&url.URL{Scheme: "http", Host: srv.Addr().String(), Path: "/"}).String())
+	require.NoError(t, err)
+	assert.Contains(t, readBody(t, resp), "served")
+	assert.Equal(t, "close", resp.Headers.Get("connection"))
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"bufio"
+	"io"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/response"
+)
+
+// Response is a received response whose body is read from the connection as the caller consumes it
+type Response struct {
+	StatusCode response.StatusCode
+	Reason     string
+	Headers    headers.Headers
+	// Body has to be closed, a fully read body lets the connection be reused
+	Body io.ReadCloser
+	// ContentLength is -1 unless the body is framed by Content-Length
+	ContentLength int64
+	// Trailers are filled in once a chunked body was read to the end
+	Trailers headers.Headers
+	// Request is the request that got this response, the last one when redirects were followed
+	Request *Request
+
+	keepAlive bool
+}
+
+// readResponse reads the final response to a method request, skipping interim 1xx responses
+func readResponse(reader *bufio.Reader, method string) (*Response, error) {
+	for {
+		parsed, err := response.ResponseFromReader(reader, method)
+		if err != nil {
+			return nil, err
+		}
+		if parsed.Informational() {
+			continue
+		}
+
+		return &Response{
+			StatusCode:    parsed.StatusCode,
+			Reason:        parsed.Reason,
+			Headers:       parsed.Headers,
+			Body:          io.NopCloser(parsed.Body),
+			ContentLength: parsed.ContentLength,
+			Trailers:      parsed.Trailers,
+			keepAlive:     parsed.KeepAlive(),
+		}, nil
+	}
+}
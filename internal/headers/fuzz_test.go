@@ -0,0 +1,47 @@
+package headers
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzHeadersParse(f *testing.F) {
+	seeds := []string{
+		"Host: localhost:42069\r\n\r\n",
+		"       Host : localhost:42069       \r\n\r\n",
+		"Host: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+		"Set-Person: lane-loves-go\r\nSet-Person: prime-loves-zig\r\n\r\n",
+		"H©st: localhost:42069\r\n\r\n",
+		"\r\n",
+		"Folded: one\r\n two\r\n\r\n",
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		h := Headers{}
+		n, done, err := h.Parse(data)
+		if err != nil {
+			if n != 0 {
+				t.Fatalf("consumed %d bytes together with %v", n, err)
+			}
+			return
+		}
+		if n < 0 || n > len(data) {
+			t.Fatalf("consumed %d of %d bytes", n, len(data))
+		}
+		if done && n != 0 {
+			t.Fatalf("done after consuming %d bytes", n)
+		}
+
+		for name, value := range h {
+			if name != strings.ToLower(name) || !fieldNameRe.MatchString(name) {
+				t.Fatalf("invalid field name %q", name)
+			}
+			if strings.ContainsAny(value, "\r\n") {
+				t.Fatalf("field value %q contains a line break", value)
+			}
+		}
+	})
+}
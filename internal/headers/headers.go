@@ -10,9 +10,16 @@ import (
 type Headers map[string]string
 
 var (
-	ERROR_MALFORMED_HEADER = fmt.Errorf("error: malformed header")
-	separator              = []byte("\r\n")
-	fieldNameRegex         = "^[a-zA-Z0-9!#$%&'*+.^_`|~-]+$"
+	ERROR_MALFORMED_HEADER    = fmt.Errorf("error: malformed header")
+	ERROR_INVALID_FIELD_NAME  = fmt.Errorf("error: invalid header field name")
+	ERROR_INVALID_FIELD_VALUE = fmt.Errorf("error: invalid header field value")
+	// ERROR_OBS_FOLD and ERROR_WHITESPACE_BEFORE_COLON reject lines that parsers disagree on,
+	// which is what request smuggling relies on, see RFC 9112 sections 5.1 and 5.2
+	ERROR_OBS_FOLD                = fmt.Errorf("error: header line folding is not allowed")
+	ERROR_WHITESPACE_BEFORE_COLON = fmt.Errorf("error: whitespace between header field name and colon")
+	separator                     = []byte("\r\n")
+	fieldNameRegex                = "^[a-zA-Z0-9!#$%&'*+.^_`|~-]+$"
+	fieldNameRe                   = regexp.MustCompile(fieldNameRegex)
 )
 
 func (h Headers) Parse(data []byte) (n int, done bool, err error) {
@@ -32,31 +39,34 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 
 		bytesRead += len(headerBytes) + len(separator)
 
-		headerBytes = bytes.Trim(headerBytes, " ")
+		if headerBytes[0] == ' ' || headerBytes[0] == '\t' {
+			return 0, false, ERROR_OBS_FOLD
+		}
 		headerTokens := bytes.SplitN(headerBytes, []byte(":"), 2)
 
 		if len(headerTokens) != 2 {
-			fmt.Printf("%s", string(headerTokens[0]))
-
 			return 0, false, ERROR_MALFORMED_HEADER
 		}
 
 		fieldName := string(headerTokens[0])
-		fieldValue := strings.Trim(string(headerTokens[1]), " ")
+		fieldValue := strings.Trim(string(headerTokens[1]), " \t")
 
-		if strings.HasSuffix(fieldName, " ") {
-			return 0, false, ERROR_MALFORMED_HEADER
+		if strings.HasSuffix(fieldName, " ") || strings.HasSuffix(fieldName, "\t") {
+			return 0, false, ERROR_WHITESPACE_BEFORE_COLON
 		}
 
-		re := regexp.MustCompile(fieldNameRegex)
-		if !re.MatchString(fieldName) {
-			return 0, false, fmt.Errorf("error: regex not matching")
+		if !fieldNameRe.MatchString(fieldName) {
+			return 0, false, ERROR_INVALID_FIELD_NAME
+		}
+		if !isValidFieldValue(fieldValue) {
+			return 0, false, ERROR_INVALID_FIELD_VALUE
 		}
 
 		fieldName = strings.ToLower(fieldName)
 
-		if h[fieldName] != "" {
-			h[fieldName] += ", " + fieldValue
+		// an empty field still counts, a later one with the same name makes it a list
+		if existing, ok := h[fieldName]; ok {
+			h[fieldName] = existing + ", " + fieldValue
 		} else {
 			h[fieldName] = fieldValue
 		}
@@ -66,6 +76,33 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 
 }
 
+// isValidFieldValue rejects control characters other than tab, a CR, LF or NUL in a value could
+// be read as the end of the field by another parser, see RFC 9110 section 5.5
+func isValidFieldValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if (value[i] < ' ' && value[i] != '\t') || value[i] == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Validate reports the first field that could not be written without changing the framing of
+// the message, names have to be tokens and values must not hold CR, LF, NUL or other controls
+func (h Headers) Validate() error {
+	for name, value := range h {
+		if !fieldNameRe.MatchString(name) {
+			return fmt.Errorf("%w: %q", ERROR_INVALID_FIELD_NAME, name)
+		}
+		if !isValidFieldValue(value) {
+			return fmt.Errorf("%w: %s", ERROR_INVALID_FIELD_VALUE, name)
+		}
+	}
+
+	return nil
+}
+
 func (h Headers) GetHeaderValue(name string) (string, error) {
 	value, ok := h[name]
 	if !ok {
@@ -74,3 +111,29 @@ func (h Headers) GetHeaderValue(name string) (string, error) {
 
 	return value, nil
 }
+
+// Get returns the value of the header name, matched case-insensitively, or an empty string
+func (h Headers) Get(name string) string {
+	return h[strings.ToLower(name)]
+}
+
+// Set stores value under the lowercased name, replacing any previous value
+func (h Headers) Set(name, value string) {
+	h[strings.ToLower(name)] = value
+}
+
+func (h Headers) Delete(name string) {
+	delete(h, strings.ToLower(name))
+}
+
+// HasToken reports whether the comma separated value of the header name lists token,
+// both matched case-insensitively
+func (h Headers) HasToken(name, token string) bool {
+	for _, item := range strings.Split(h.Get(name), ",") {
+		if strings.EqualFold(strings.TrimSpace(item), token) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -41,7 +41,7 @@ func TestHeaderParse(t *testing.T) {
 
 	// Test: Valid 2 headers with existing headers
 	headers = NewHeaders()
-	data = []byte("Host: localhost:42069                   \r\n Foo: BarBar\r\n")
+	data = []byte("Host: localhost:42069                   \r\nFoo: BarBar\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
@@ -68,11 +68,51 @@ func TestHeaderParse(t *testing.T) {
 
 	// Test: Valid 2 headers with same header
 	headers = NewHeaders()
-	data = []byte("Set-Person: lane-loves-go           \r\n  Set-Person: prime-loves-zig\r\n   Set-Person: tj-loves-ocaml \r\n")
+	data = []byte("Set-Person: lane-loves-go           \r\nSet-Person: prime-loves-zig\r\nSet-Person: tj-loves-ocaml \r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
 	assert.Equal(t, "lane-loves-go, prime-loves-zig, tj-loves-ocaml", headers["set-person"])
 	assert.Equal(t, len(data), n)
 	assert.False(t, done)
+
+	// Test: An empty field is kept when the same header follows
+	headers = NewHeaders()
+	data = []byte("Content-Length:\r\nContent-Length: 5\r\n")
+	n, done, err = headers.Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, ", 5", headers["content-length"])
+	assert.Equal(t, len(data), n)
+	assert.False(t, done)
+
+	// Test: Folded header lines
+	for _, data := range []string{
+		"Host: localhost:42069\r\n Foo: BarBar\r\n\r\n",
+		"Host: localhost\r\n\t:42069\r\n\r\n",
+	} {
+		headers = NewHeaders()
+		n, _, err = headers.Parse([]byte(data))
+		assert.ErrorIs(t, err, ERROR_OBS_FOLD, data)
+		assert.Equal(t, 0, n)
+	}
+
+	// Test: Whitespace before the colon
+	for _, data := range []string{"Host : localhost\r\n\r\n", "Host\t: localhost\r\n\r\n"} {
+		headers = NewHeaders()
+		_, _, err = headers.Parse([]byte(data))
+		assert.ErrorIs(t, err, ERROR_WHITESPACE_BEFORE_COLON, data)
+	}
+}
+
+func TestHasToken(t *testing.T) {
+	headers := Headers{}
+	headers.Set("Connection", "keep-alive, Upgrade")
+
+	// Test: Tokens of the list match whatever their case
+	assert.True(t, headers.HasToken("connection", "upgrade"))
+	assert.True(t, headers.HasToken("CONNECTION", "Keep-Alive"))
+
+	// Test: Partial tokens and missing headers do not match
+	assert.False(t, headers.HasToken("connection", "keep"))
+	assert.False(t, headers.HasToken("upgrade", "websocket"))
 }
@@ -0,0 +1,88 @@
+package request
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	DEFAULT_MAX_DECODED_BODY_SIZE = 10 * 1024 * 1024
+)
+
+var (
+	ERROR_UNSUPPORTED_CONTENT_ENCODING = fmt.Errorf("error: unsupported content encoding")
+	ERROR_DECODED_BODY_TOO_LARGE       = fmt.Errorf("error: decoded body is larger than allowed")
+	ERROR_MALFORMED_ENCODED_BODY       = fmt.Errorf("error: body does not match its content encoding")
+)
+
+// DecodeBody undoes the gzip or deflate codings listed in Content-Encoding so Body holds the
+// original bytes. It stops with ERROR_DECODED_BODY_TOO_LARGE once more than maxSize bytes were
+// decoded, which protects against small bodies that expand enormously.
+func (r *Request) DecodeBody(maxSize int64) error {
+	contentEncoding := r.Headers.Get("content-encoding")
+	if contentEncoding == "" {
+		return nil
+	}
+
+	codings := strings.Split(contentEncoding, ",")
+	for _, coding := range codings {
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip", "x-gzip", "deflate", "identity":
+		default:
+			return ERROR_UNSUPPORTED_CONTENT_ENCODING
+		}
+	}
+
+	body := r.Body
+	// codings are listed in the order they were applied
+	for i := len(codings) - 1; i >= 0; i-- {
+		decoded, err := decodeBody(strings.ToLower(strings.TrimSpace(codings[i])), body, maxSize)
+		if err != nil {
+			return err
+		}
+		body = decoded
+	}
+
+	r.Body = body
+	r.Headers.Delete("content-encoding")
+	r.Headers.Set("content-length", fmt.Sprintf("%d", len(body)))
+
+	return nil
+}
+
+func decodeBody(coding string, body []byte, maxSize int64) ([]byte, error) {
+	var decoder io.Reader
+	switch coding {
+	case "gzip", "x-gzip":
+		gzipReader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, ERROR_MALFORMED_ENCODED_BODY
+		}
+		decoder = gzipReader
+	case "deflate":
+		zlibReader, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			// some clients send raw DEFLATE data without the zlib wrapper
+			decoder = flate.NewReader(bytes.NewReader(body))
+		} else {
+			decoder = zlibReader
+		}
+	default:
+		return body, nil
+	}
+
+	decoded, err := io.ReadAll(io.LimitReader(decoder, maxSize+1))
+	if err != nil {
+		return nil, ERROR_MALFORMED_ENCODED_BODY
+	}
+	if int64(len(decoded)) > maxSize {
+		return nil, ERROR_DECODED_BODY_TOO_LARGE
+	}
+
+	return decoded, nil
+}
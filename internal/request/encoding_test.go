@@ -0,0 +1,91 @@
+package request
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"testing"
+
+	"httpfromtcp/internal/headers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	buffer := &bytes.Buffer{}
+	writer := gzip.NewWriter(buffer)
+	_, err := writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buffer.Bytes()
+}
+
+func zlibBytes(t *testing.T, data []byte) []byte {
+	buffer := &bytes.Buffer{}
+	writer := zlib.NewWriter(buffer)
+	_, err := writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buffer.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	payload := []byte("{\"hello\":\"world\"}")
+
+	// Test: gzip body read from the wire
+	compressed := gzipBytes(t, payload)
+	reader := &chunkReader{
+		data: fmt.Sprintf("POST /upload HTTP/1.1\r\n"+
+			"Host: localhost:42069\r\n"+
+			"Content-Encoding: gzip\r\n"+
+			"Content-Length: %d\r\n"+
+			"\r\n%s", len(compressed), compressed),
+		numBytesPerRead: 8,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NoError(t, r.DecodeBody(DEFAULT_MAX_DECODED_BODY_SIZE))
+	assert.Equal(t, payload, r.Body)
+	assert.Equal(t, "", r.Headers.Get("content-encoding"))
+	assert.Equal(t, fmt.Sprintf("%d", len(payload)), r.Headers.Get("content-length"))
+
+	// Test: deflate with and without the zlib wrapper
+	r = &Request{Headers: headers.Headers{"content-encoding": "deflate"}, Body: zlibBytes(t, payload)}
+	require.NoError(t, r.DecodeBody(DEFAULT_MAX_DECODED_BODY_SIZE))
+	assert.Equal(t, payload, r.Body)
+
+	raw := &bytes.Buffer{}
+	flateWriter, err := flate.NewWriter(raw, flate.DefaultCompression)
+	require.NoError(t, err)
+	flateWriter.Write(payload)
+	flateWriter.Close()
+	r = &Request{Headers: headers.Headers{"content-encoding": "deflate"}, Body: raw.Bytes()}
+	require.NoError(t, r.DecodeBody(DEFAULT_MAX_DECODED_BODY_SIZE))
+	assert.Equal(t, payload, r.Body)
+
+	// Test: Stacked codings are undone in reverse order
+	r = &Request{Headers: headers.Headers{"content-encoding": "deflate, gzip"}, Body: gzipBytes(t, zlibBytes(t, payload))}
+	require.NoError(t, r.DecodeBody(DEFAULT_MAX_DECODED_BODY_SIZE))
+	assert.Equal(t, payload, r.Body)
+
+	// Test: No content encoding leaves the body alone
+	r = &Request{Headers: headers.Headers{}, Body: payload}
+	require.NoError(t, r.DecodeBody(DEFAULT_MAX_DECODED_BODY_SIZE))
+	assert.Equal(t, payload, r.Body)
+
+	// Test: Unsupported encoding
+	r = &Request{Headers: headers.Headers{"content-encoding": "br"}, Body: payload}
+	require.ErrorIs(t, r.DecodeBody(DEFAULT_MAX_DECODED_BODY_SIZE), ERROR_UNSUPPORTED_CONTENT_ENCODING)
+
+	// Test: Zip bomb
+	bomb := gzipBytes(t, make([]byte, 1024*1024))
+	r = &Request{Headers: headers.Headers{"content-encoding": "gzip"}, Body: bomb}
+	require.ErrorIs(t, r.DecodeBody(1024), ERROR_DECODED_BODY_TOO_LARGE)
+
+	// Test: Body is not gzip
+	r = &Request{Headers: headers.Headers{"content-encoding": "gzip"}, Body: payload}
+	require.ErrorIs(t, r.DecodeBody(DEFAULT_MAX_DECODED_BODY_SIZE), ERROR_MALFORMED_ENCODED_BODY)
+}
@@ -0,0 +1,223 @@
+package request
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"strings"
+
+	"httpfromtcp/internal/headers"
+)
+
+const (
+	// DEFAULT_MAX_FORM_SIZE limits url-encoded forms and the field values of multipart forms
+	DEFAULT_MAX_FORM_SIZE  = 1024 * 1024
+	DEFAULT_MAX_FILE_SIZE  = DEFAULT_MAX_BODY_SIZE
+	DEFAULT_MAX_FORM_PARTS = 1000
+)
+
+var (
+	ERROR_UNSUPPORTED_CONTENT_TYPE = fmt.Errorf("error: unsupported content type")
+	ERROR_MALFORMED_FORM           = fmt.Errorf("error: malformed form body")
+	ERROR_FORM_TOO_LARGE           = fmt.Errorf("error: form has more or larger parts than allowed")
+)
+
+// MultipartLimits bounds the multipart forms ParseMultipartForm accepts, fields left at 0 use
+// the defaults
+type MultipartLimits struct {
+	// MaxFieldsSize limits the values of all parts that are not files, DEFAULT_MAX_FORM_SIZE when 0
+	MaxFieldsSize int64
+	// MaxFileSize limits every single file, DEFAULT_MAX_FILE_SIZE when 0
+	MaxFileSize int64
+	// MaxParts limits the number of parts, DEFAULT_MAX_FORM_PARTS when 0
+	MaxParts int
+}
+
+// FilePart is a file of a multipart form. Reading it fails with ERROR_FORM_TOO_LARGE once it
+// is larger than MultipartLimits.MaxFileSize.
+type FilePart struct {
+	FieldName string
+	FileName  string
+	// Headers of the part, e.g. its content-type
+	Headers headers.Headers
+	io.Reader
+}
+
+// ParseForm parses an application/x-www-form-urlencoded body of at most maxSize bytes,
+// DEFAULT_MAX_FORM_SIZE when 0, reading it first when ReadBody was not called yet
+func (r *Request) ParseForm(maxSize int64) (url.Values, error) {
+	if mediaType, _, err := mime.ParseMediaType(r.Headers.Get("content-type")); err != nil || mediaType != "application/x-www-form-urlencoded" {
+		return nil, ERROR_UNSUPPORTED_CONTENT_TYPE
+	}
+	if maxSize <= 0 {
+		maxSize = DEFAULT_MAX_FORM_SIZE
+	}
+	if err := r.readBodyUpTo(maxSize); err != nil {
+		return nil, err
+	}
+
+	values, err := url.ParseQuery(string(r.Body))
+	if err != nil {
+		return nil, ERROR_MALFORMED_FORM
+	}
+
+	return values, nil
+}
+
+// ParseMultipartForm parses a multipart/form-data body, returning the values of the parts that
+// are not files. The body is parsed while it is read from the client without being collected in
+// Body, so only limits bound it, unless ReadBody already read it or it has to be decoded, see
+// MaxDecodedBodySize. File parts are passed to onFile while the body is parsed, the FilePart can
+// only be read until onFile returns and whatever it did not read is skipped. Files are skipped
+// too when onFile is nil. An error returned by onFile stops parsing and is returned as is.
+func (r *Request) ParseMultipartForm(limits MultipartLimits, onFile func(file *FilePart) error) (url.Values, error) {
+	mediaType, params, err := mime.ParseMediaType(r.Headers.Get("content-type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, ERROR_UNSUPPORTED_CONTENT_TYPE
+	}
+	if params["boundary"] == "" {
+		return nil, ERROR_MALFORMED_FORM
+	}
+	if r.MaxDecodedBodySize > 0 && r.Headers.Get("content-encoding") != "" {
+		if err := r.ReadBody(); err != nil {
+			return nil, err
+		}
+	}
+
+	var body io.Reader = bytes.NewReader(r.Body)
+	stream := r.bodyStream()
+	if r.State != REQUEST_STATE_DONE {
+		body = stream
+	}
+	// failures reading the client are reported as they are rather than as a malformed form
+	formError := func(err error) error {
+		if stream.err != nil {
+			return stream.err
+		}
+		return err
+	}
+
+	reader := multipart.NewReader(body, params["boundary"])
+	values := url.Values{}
+	fieldsSize := limits.maxFieldsSize()
+	for parts := 0; ; parts++ {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, formError(ERROR_MALFORMED_FORM)
+		}
+		if parts >= limits.maxParts() {
+			return nil, ERROR_FORM_TOO_LARGE
+		}
+		if part.FormName() == "" {
+			return nil, ERROR_MALFORMED_FORM
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(&limitedReader{reader: part, remaining: fieldsSize})
+			if err != nil {
+				return nil, formError(err)
+			}
+			fieldsSize -= int64(len(value))
+			values.Add(part.FormName(), string(value))
+			continue
+		}
+
+		file := &FilePart{
+			FieldName: part.FormName(),
+			FileName:  part.FileName(),
+			Headers:   headers.Headers{},
+			Reader:    &limitedReader{reader: part, remaining: limits.maxFileSize()},
+		}
+		for name, fieldValues := range part.Header {
+			file.Headers.Set(name, strings.Join(fieldValues, ", "))
+		}
+		if onFile != nil {
+			if err := onFile(file); err != nil {
+				return nil, err
+			}
+		}
+		// the limit applies to the bytes onFile left unread as well
+		if _, err := io.Copy(io.Discard, file.Reader); err != nil {
+			return nil, formError(err)
+		}
+	}
+}
+
+func (l MultipartLimits) maxFieldsSize() int64 {
+	if l.MaxFieldsSize > 0 {
+		return l.MaxFieldsSize
+	}
+
+	return DEFAULT_MAX_FORM_SIZE
+}
+
+func (l MultipartLimits) maxFileSize() int64 {
+	if l.MaxFileSize > 0 {
+		return l.MaxFileSize
+	}
+
+	return DEFAULT_MAX_FILE_SIZE
+}
+
+func (l MultipartLimits) maxParts() int {
+	if l.MaxParts > 0 {
+		return l.MaxParts
+	}
+
+	return DEFAULT_MAX_FORM_PARTS
+}
+
+// readBodyUpTo reads the body like ReadBody, refusing a body announced to be larger than
+// maxSize before reading it
+func (r *Request) readBodyUpTo(maxSize int64) error {
+	if r.State != REQUEST_STATE_DONE && maxSize < r.maxBodySize() {
+		r.MaxBodySize = maxSize
+	}
+	if err := r.ReadBody(); err != nil {
+		return err
+	}
+	if int64(len(r.Body)) > maxSize {
+		return ERROR_BODY_TOO_LARGE
+	}
+
+	return nil
+}
+
+// limitedReader reads a form part, failing with ERROR_FORM_TOO_LARGE once the part has more
+// than remaining bytes
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(data []byte) (int, error) {
+	if l.remaining <= 0 {
+		// one more byte tells a part of exactly the allowed size from a larger one
+		_, err := io.ReadFull(l.reader, make([]byte, 1))
+		switch err {
+		case nil:
+			return 0, ERROR_FORM_TOO_LARGE
+		case io.EOF:
+			return 0, io.EOF
+		default:
+			return 0, ERROR_MALFORMED_FORM
+		}
+	}
+
+	if int64(len(data)) > l.remaining {
+		data = data[:l.remaining]
+	}
+	n, err := l.reader.Read(data)
+	l.remaining -= int64(n)
+	if err != nil && err != io.EOF {
+		err = ERROR_MALFORMED_FORM
+	}
+
+	return n, err
+}
@@ -0,0 +1,174 @@
+package request
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func bodyRequest(t *testing.T, contentType string, body string) *Request {
+	reader := &chunkReader{
+		data:            fmt.Sprintf("POST /form HTTP/1.1\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s", contentType, len(body), body),
+		numBytesPerRead: 5,
+	}
+	r, err := RequestHeadFromReader(reader)
+	require.NoError(t, err)
+	return r
+}
+
+func multipartBody(t *testing.T, write func(writer *multipart.Writer)) (string, string) {
+	buffer := &bytes.Buffer{}
+	writer := multipart.NewWriter(buffer)
+	write(writer)
+	require.NoError(t, writer.Close())
+	return writer.FormDataContentType(), buffer.String()
+}
+
+func TestParseForm(t *testing.T) {
+	// Test: Url-encoded values
+	r := bodyRequest(t, "application/x-www-form-urlencoded; charset=utf-8", "name=gopher&tag=a&tag=b%26c&empty=")
+	values, err := r.ParseForm(0)
+	require.NoError(t, err)
+	assert.Equal(t, "gopher", values.Get("name"))
+	assert.Equal(t, []string{"a", "b&c"}, values["tag"])
+	assert.True(t, values.Has("empty"))
+
+	// Test: Other content types are not parsed
+	r = bodyRequest(t, "text/plain", "name=gopher")
+	_, err = r.ParseForm(0)
+	assert.ErrorIs(t, err, ERROR_UNSUPPORTED_CONTENT_TYPE)
+	assert.Empty(t, r.Body)
+
+	// Test: Malformed escapes
+	r = bodyRequest(t, "application/x-www-form-urlencoded", "name=%zz")
+	_, err = r.ParseForm(0)
+	assert.ErrorIs(t, err, ERROR_MALFORMED_FORM)
+
+	// Test: Forms larger than maxSize are refused before they are read
+	r = bodyRequest(t, "application/x-www-form-urlencoded", "name=gopher")
+	_, err = r.ParseForm(4)
+	assert.ErrorIs(t, err, ERROR_BODY_TOO_LARGE)
+	assert.Empty(t, r.Body)
+}
+
+func TestParseMultipartForm(t *testing.T) {
+	contentType, body := multipartBody(t, func(writer *multipart.Writer) {
+		require.NoError(t, writer.WriteField("title", "holiday"))
+		require.NoError(t, writer.WriteField("tag", "sea"))
+		file, err := writer.CreateFormFile("photo", "beach.jpg")
+		require.NoError(t, err)
+		file.Write([]byte("jpeg bytes"))
+		file, err = writer.CreateFormFile("photo", "sunset.jpg")
+		require.NoError(t, err)
+		file.Write([]byte("more jpeg bytes"))
+	})
+
+	// Test: Fields are collected and files streamed
+	files := map[string]string{}
+	r := bodyRequest(t, contentType, body)
+	values, err := r.ParseMultipartForm(MultipartLimits{}, func(file *FilePart) error {
+		assert.Equal(t, "photo", file.FieldName)
+		assert.Equal(t, "application/octet-stream", file.Headers.Get("content-type"))
+		data, err := io.ReadAll(file)
+		files[file.FileName] = string(data)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "holiday", values.Get("title"))
+	assert.Equal(t, "sea", values.Get("tag"))
+	assert.Equal(t, map[string]string{"beach.jpg": "jpeg bytes", "sunset.jpg": "more jpeg bytes"}, files)
+
+	// Test: Files are skipped without onFile
+	values, err = bodyRequest(t, contentType, body).ParseMultipartForm(MultipartLimits{}, nil)
+	require.NoError(t, err)
+	assert.Len(t, values, 2)
+
+	// Test: Errors of onFile stop parsing
+	stop := fmt.Errorf("stop")
+	_, err = bodyRequest(t, contentType, body).ParseMultipartForm(MultipartLimits{}, func(file *FilePart) error {
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+
+	// Test: Limits
+	for _, limits := range []MultipartLimits{{MaxFieldsSize: 9}, {MaxFileSize: 12}, {MaxParts: 3}} {
+		_, err = bodyRequest(t, contentType, body).ParseMultipartForm(limits, nil)
+		assert.ErrorIs(t, err, ERROR_FORM_TOO_LARGE, limits)
+	}
+	_, err = bodyRequest(t, contentType, body).ParseMultipartForm(MultipartLimits{MaxFieldsSize: 10, MaxFileSize: 15, MaxParts: 4}, nil)
+	assert.NoError(t, err)
+
+	// Test: Files larger than MaxFileSize fail while onFile reads them
+	_, err = bodyRequest(t, contentType, body).ParseMultipartForm(MultipartLimits{MaxFileSize: 12}, func(file *FilePart) error {
+		_, err := io.ReadAll(file)
+		return err
+	})
+	assert.ErrorIs(t, err, ERROR_FORM_TOO_LARGE)
+
+	// Test: Files larger than MaxBodySize are streamed without collecting the body
+	large := strings.Repeat("x", 4096)
+	largeType, largeBody := multipartBody(t, func(writer *multipart.Writer) {
+		file, err := writer.CreateFormFile("upload", "large.bin")
+		require.NoError(t, err)
+		file.Write([]byte(large))
+	})
+	r = bodyRequest(t, largeType, largeBody)
+	r.MaxBodySize = 1024
+	received := 0
+	_, err = r.ParseMultipartForm(MultipartLimits{}, func(file *FilePart) error {
+		data, err := io.ReadAll(file)
+		received += len(data)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, len(large), received)
+	assert.Less(t, cap(r.Body), 1024)
+	assert.ErrorIs(t, bodyRequest(t, largeType, largeBody).readBodyUpTo(1024), ERROR_BODY_TOO_LARGE)
+
+	// Test: Chunked bodies are streamed too
+	chunked := ""
+	for i := 0; i < len(largeBody); i += 512 {
+		chunk := largeBody[i:min(i+512, len(largeBody))]
+		chunked += fmt.Sprintf("%x\r\n%s\r\n", len(chunk), chunk)
+	}
+	r, err = RequestHeadFromReader(&chunkReader{
+		data:            "POST /form HTTP/1.1\r\nContent-Type: " + largeType + "\r\nTransfer-Encoding: chunked\r\n\r\n" + chunked + "0\r\n\r\n",
+		numBytesPerRead: 100,
+	})
+	require.NoError(t, err)
+	r.MaxBodySize = 1024
+	received = 0
+	_, err = r.ParseMultipartForm(MultipartLimits{}, func(file *FilePart) error {
+		data, err := io.ReadAll(file)
+		received += len(data)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, len(large), received)
+
+	// Test: Errors reading the client are returned as they are
+	r, err = RequestHeadFromReader(strings.NewReader("POST /form HTTP/1.1\r\nContent-Type: " + largeType + "\r\nContent-Length: " + fmt.Sprint(len(largeBody)) + "\r\n\r\n" + largeBody[:100]))
+	require.NoError(t, err)
+	_, err = r.ParseMultipartForm(MultipartLimits{}, nil)
+	assert.ErrorIs(t, err, ERROR_INCOMPLETE_REQUEST)
+
+	// Test: Malformed forms
+	for contentType, body := range map[string]string{
+		"multipart/form-data":                 body,
+		"multipart/form-data; boundary=other": body,
+		"multipart/form-data; boundary=x":     "--x\r\nContent-Disposition: form-data\r\n\r\nvalue\r\n--x--\r\n",
+	} {
+		_, err = bodyRequest(t, contentType, body).ParseMultipartForm(MultipartLimits{}, nil)
+		assert.ErrorIs(t, err, ERROR_MALFORMED_FORM, contentType)
+	}
+
+	// Test: Other content types are not parsed
+	_, err = bodyRequest(t, "application/x-www-form-urlencoded", "title=holiday").ParseMultipartForm(MultipartLimits{}, nil)
+	assert.ErrorIs(t, err, ERROR_UNSUPPORTED_CONTENT_TYPE)
+}
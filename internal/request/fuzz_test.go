@@ -0,0 +1,66 @@
+package request
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzRequestFromReader(f *testing.F) {
+	seeds := []string{
+		"GET / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+		"POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 13\r\n\r\nhello world!\n",
+		"POST /upload HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n6\r\nhello \r\n7;ext=1\r\nworld!\n\r\n0\r\nX-Checksum: abc\r\n\r\n",
+		"POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello",
+		"GET /coffee HTTP/1.1\r\n\r\n",
+		"/coffee HTTP/1.1\r\n\r\n",
+		"POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n",
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nffffffffffffffff\r\n",
+		"post / HTTP/1.1\nX-Folded: one\r\n two\nContent-Length: 2\n\nok",
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed), uint8(3))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, numBytesPerRead uint8) {
+		reader := &chunkReader{data: string(data), numBytesPerRead: int(numBytesPerRead)%16 + 1}
+		r, err := RequestFromReader(reader)
+		if err != nil && r != nil {
+			t.Fatalf("got a request together with %v", err)
+		}
+
+		// leniency only adds to what is accepted, and strict requests have no deviations
+		leniency := Leniency{BareLF: true, ObsFold: true, LowercaseMethods: true}
+		reader = &chunkReader{data: string(data), numBytesPerRead: int(numBytesPerRead)%16 + 1}
+		lenient, lenientErr := RequestFromReader(reader, WithLeniency(leniency))
+		if err == nil && (lenientErr != nil || len(lenient.Deviations) > 0 || !bytes.Equal(lenient.Body, r.Body)) {
+			t.Fatalf("lenient parsing of a strict request failed with %v", lenientErr)
+		}
+		if lenientErr != nil {
+			return
+		}
+		r = lenient
+
+		if r.State != REQUEST_STATE_DONE {
+			t.Fatalf("request returned in state %d", r.State)
+		}
+		if r.RequestLine.Method == "" || r.RequestLine.RequestTarget == "" {
+			t.Fatalf("request line %+v is incomplete", r.RequestLine)
+		}
+		if len(r.Body) > len(data) {
+			t.Fatalf("body of %d bytes from %d bytes of input", len(r.Body), len(data))
+		}
+
+		// whatever was accepted survives writing it back
+		buffer := &bytes.Buffer{}
+		if err := r.Write(buffer); err != nil {
+			t.Fatalf("writing the parsed request: %v", err)
+		}
+		written, err := RequestFromReader(&chunkReader{data: buffer.String(), numBytesPerRead: 7})
+		if err != nil {
+			t.Fatalf("parsing the written request %q: %v", buffer.String(), err)
+		}
+		if !bytes.Equal(written.Body, r.Body) {
+			t.Fatalf("body changed from %q to %q", r.Body, written.Body)
+		}
+	})
+}
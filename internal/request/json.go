@@ -0,0 +1,57 @@
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+const (
+	DEFAULT_MAX_JSON_SIZE = 1024 * 1024
+)
+
+var (
+	ERROR_MALFORMED_JSON = fmt.Errorf("error: malformed json body")
+)
+
+type JSONOptions struct {
+	// DisallowUnknownFields rejects object keys matching no field of the value decoded into
+	DisallowUnknownFields bool
+	// MaxSize limits the body, DEFAULT_MAX_JSON_SIZE when 0
+	MaxSize int64
+}
+
+// DecodeJSON decodes a body of content type application/json, or any +json type, into v,
+// reading it first when ReadBody was not called yet. The body has to hold a single JSON value.
+func (r *Request) DecodeJSON(v any, options JSONOptions) error {
+	mediaType, _, err := mime.ParseMediaType(r.Headers.Get("content-type"))
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return ERROR_UNSUPPORTED_CONTENT_TYPE
+	}
+	maxSize := options.MaxSize
+	if maxSize <= 0 {
+		maxSize = DEFAULT_MAX_JSON_SIZE
+	}
+	if err := r.readBodyUpTo(maxSize); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(r.Body))
+	if options.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		if _, ok := err.(*json.InvalidUnmarshalError); ok {
+			return err
+		}
+		return fmt.Errorf("%w: %s", ERROR_MALFORMED_JSON, err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("%w: data after the value", ERROR_MALFORMED_JSON)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package request
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type order struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	// Test: JSON and +json content types
+	for _, contentType := range []string{"application/json", "application/json; charset=utf-8", "application/merge-patch+json"} {
+		var decoded order
+		err := bodyRequest(t, contentType, `{"item": "coffee", "quantity": 2}`).DecodeJSON(&decoded, JSONOptions{})
+		require.NoError(t, err, contentType)
+		assert.Equal(t, order{Item: "coffee", Quantity: 2}, decoded)
+	}
+
+	// Test: Unknown fields are only rejected when asked to
+	body := `{"item": "coffee", "size": "large"}`
+	var decoded order
+	require.NoError(t, bodyRequest(t, "application/json", body).DecodeJSON(&decoded, JSONOptions{}))
+	err := bodyRequest(t, "application/json", body).DecodeJSON(&decoded, JSONOptions{DisallowUnknownFields: true})
+	assert.ErrorIs(t, err, ERROR_MALFORMED_JSON)
+	assert.Contains(t, err.Error(), "size")
+
+	// Test: Malformed bodies
+	for _, body := range []string{"", `{"item": `, `{"quantity": "two"}`, `{} {}`, `{}}`} {
+		err = bodyRequest(t, "application/json", body).DecodeJSON(&decoded, JSONOptions{})
+		assert.ErrorIs(t, err, ERROR_MALFORMED_JSON, body)
+	}
+
+	// Test: Bodies larger than MaxSize are refused before they are read
+	r := bodyRequest(t, "application/json", `{"item": "`+strings.Repeat("a", 64)+`"}`)
+	err = r.DecodeJSON(&decoded, JSONOptions{MaxSize: 32})
+	assert.ErrorIs(t, err, ERROR_BODY_TOO_LARGE)
+	assert.Empty(t, r.Body)
+
+	// Test: Other content types are not decoded
+	err = bodyRequest(t, "text/plain", `{}`).DecodeJSON(&decoded, JSONOptions{})
+	assert.ErrorIs(t, err, ERROR_UNSUPPORTED_CONTENT_TYPE)
+}
@@ -0,0 +1,90 @@
+package request
+
+import (
+	"regexp"
+	"sync/atomic"
+)
+
+// Deviation names a departure from RFC 9112 a lenient parser accepted a request with
+type Deviation string
+
+const (
+	DEVIATION_BARE_LF          Deviation = "bare-lf"
+	DEVIATION_OBS_FOLD         Deviation = "obs-fold"
+	DEVIATION_LOWERCASE_METHOD Deviation = "lowercase-method"
+)
+
+var (
+	lenientMethodRe = regexp.MustCompile("^[A-Za-z]+$")
+)
+
+// Leniency is the profile of deviations the parser accepts and normalises, the zero value
+// parses strictly
+type Leniency struct {
+	// BareLF accepts lines of the head ended by a LF alone, rewriting them to CRLF, see
+	// RFC 9112 section 2.2
+	BareLF bool
+	// ObsFold accepts header values continued on lines starting with whitespace, joining
+	// the lines with a single space, see RFC 9112 section 5.2
+	ObsFold bool
+	// LowercaseMethods accepts methods in any case, uppercasing them
+	LowercaseMethods bool
+	// Counters, when set, counts the requests accepted with each deviation
+	Counters *LeniencyCounters
+}
+
+// LeniencyCounters counts the requests parsed with each deviation, it can be shared by
+// concurrent parsers
+type LeniencyCounters struct {
+	bareLF          atomic.Int64
+	obsFold         atomic.Int64
+	lowercaseMethod atomic.Int64
+}
+
+// ParseOption changes the rules RequestFromReader and RequestHeadFromReader parse requests with
+type ParseOption func(*requestParser)
+
+// WithLeniency accepts the deviations enabled in leniency
+func WithLeniency(leniency Leniency) ParseOption {
+	return func(p *requestParser) {
+		p.leniency = leniency
+	}
+}
+
+// WithBareLF accepts lines of the head ended by a LF alone, see Leniency.BareLF
+func WithBareLF() ParseOption {
+	return func(p *requestParser) {
+		p.leniency.BareLF = true
+	}
+}
+
+// Count returns how many requests were accepted with deviation
+func (c *LeniencyCounters) Count(deviation Deviation) int64 {
+	if counter := c.counter(deviation); counter != nil {
+		return counter.Load()
+	}
+
+	return 0
+}
+
+func (c *LeniencyCounters) counter(deviation Deviation) *atomic.Int64 {
+	switch deviation {
+	case DEVIATION_BARE_LF:
+		return &c.bareLF
+	case DEVIATION_OBS_FOLD:
+		return &c.obsFold
+	case DEVIATION_LOWERCASE_METHOD:
+		return &c.lowercaseMethod
+	default:
+		return nil
+	}
+}
+
+// deviate records that the request relied on deviation
+func (r *Request) deviate(deviation Deviation) {
+	r.Deviations = append(r.Deviations, deviation)
+
+	if counters := r.parser.leniency.Counters; counters != nil {
+		counters.counter(deviation).Add(1)
+	}
+}
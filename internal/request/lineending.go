@@ -0,0 +1,133 @@
+package request
+
+import (
+	"fmt"
+	"io"
+)
+
+var (
+	ERROR_BARE_LF = fmt.Errorf("error: line in request head not ended by CRLF")
+)
+
+// lineEndingReader checks that every line of the request head ends with CRLF, rewriting bare LF
+// line endings and joining folded header lines when the leniency allows them. Everything after
+// the empty line ending the head is passed through unchanged.
+type lineEndingReader struct {
+	reader   io.Reader
+	leniency Leniency
+	// pending holds the checked bytes not returned yet, and err the error to return after them
+	pending []byte
+	err     error
+
+	lines      int
+	lineLength int
+	headDone   bool
+	sawCR      bool
+	// heldLineEnd is set when a header line ended and the next line could be a continuation
+	heldLineEnd bool
+	folding     bool
+	rewroteLF   bool
+	unfolded    bool
+}
+
+func (l *lineEndingReader) Read(data []byte) (int, error) {
+	for len(l.pending) == 0 && l.err == nil {
+		if l.headDone {
+			return l.reader.Read(data)
+		}
+
+		n, err := l.reader.Read(data)
+		for i, b := range data[:n] {
+			if l.headDone {
+				l.pending = append(l.pending, data[i:n]...)
+				break
+			}
+			if err := l.check(b); err != nil {
+				l.pending = nil
+				return 0, err
+			}
+		}
+		if err != nil {
+			l.flush()
+			l.err = err
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	n := copy(data, l.pending)
+	l.pending = l.pending[n:]
+	if len(l.pending) > 0 {
+		return n, nil
+	}
+
+	return n, l.err
+}
+
+// check appends b to pending once it is known how the line it is part of ends
+func (l *lineEndingReader) check(b byte) error {
+	if l.heldLineEnd {
+		l.heldLineEnd = false
+		if b == ' ' || b == '\t' {
+			l.unfolded = true
+			l.folding = true
+			l.pending = append(l.pending, ' ')
+			return nil
+		}
+		l.pending = append(l.pending, SEPARATOR...)
+	}
+	if l.folding {
+		if b == ' ' || b == '\t' {
+			return nil
+		}
+		l.folding = false
+	}
+
+	if l.sawCR {
+		l.sawCR = false
+		if b != '\n' {
+			// a CR inside a line is left for the request line and header checks to reject
+			l.pending = append(l.pending, '\r')
+		}
+	} else if b == '\n' {
+		if !l.leniency.BareLF {
+			return ERROR_BARE_LF
+		}
+		l.rewroteLF = true
+	}
+
+	switch {
+	case b == '\r':
+		l.sawCR = true
+	case b != '\n':
+		l.lineLength++
+		l.pending = append(l.pending, b)
+	case l.lineLength == 0 && l.lines > 0:
+		l.headDone = true
+		l.pending = append(l.pending, SEPARATOR...)
+	default:
+		// empty lines before the request line do not end the head
+		l.lines++
+		l.lineLength = 0
+		if l.leniency.ObsFold && l.lines > 1 {
+			l.heldLineEnd = true
+		} else {
+			l.pending = append(l.pending, SEPARATOR...)
+		}
+	}
+
+	return nil
+}
+
+// flush gives up the bytes held back for bytes that will not be read anymore
+func (l *lineEndingReader) flush() {
+	if l.heldLineEnd {
+		l.heldLineEnd = false
+		l.pending = append(l.pending, SEPARATOR...)
+	}
+	if l.sawCR {
+		l.sawCR = false
+		l.pending = append(l.pending, '\r')
+	}
+}
@@ -1,6 +1,8 @@
 package request
 
 import (
+	"bytes"
+	"crypto/tls"
 	"fmt"
 	"httpfromtcp/internal/headers"
 	"io"
@@ -13,7 +15,42 @@ type Request struct {
 	RequestLine RequestLine
 	Headers     headers.Headers
 	Body        []byte
-	State       int
+	// Trailers are the fields sent after a chunked body
+	Trailers headers.Headers
+	State    int
+	// RemoteAddr is set by the server to the address of the client
+	RemoteAddr string
+	// TLS is set by the server for requests received over TLS
+	TLS *tls.ConnectionState
+	// MaxDecodedBodySize makes ReadBody decode gzip and deflate bodies, see DecodeBody
+	MaxDecodedBodySize int64
+	// MaxBodySize limits the body ReadBody accepts, DEFAULT_MAX_BODY_SIZE when 0
+	MaxBodySize int64
+	// Deviations lists what the request was only accepted with because of the parser's Leniency
+	Deviations []Deviation
+
+	parser *requestParser
+}
+
+// requestParser holds the bytes read from the client that were not parsed yet
+type requestParser struct {
+	reader                   io.Reader
+	requestData              []byte
+	bytesRead                int
+	bytesParsed              int
+	contentLengthHeaderValue int
+	chunked                  bool
+	// bodyParsed counts the body bytes parsed so far, streamed ones included
+	bodyParsed int
+	// streaming bodies are handed out as they arrive, see bodyStream
+	streaming bool
+	// headBytes counts the request line and header bytes parsed so far, see MAX_HEADER_SIZE
+	headBytes int
+	// lineSearched counts the buffered bytes already searched for the end of a line
+	lineSearched     int
+	leniency         Leniency
+	lineEndings      *lineEndingReader
+	uppercasedMethod bool
 }
 
 type RequestLine struct {
@@ -23,10 +60,21 @@ type RequestLine struct {
 }
 
 var (
-	requestData              []byte
-	bytesRead                int
-	bytesParsed              int
-	contentLengthHeaderValue int
+	ERROR_INCOMPLETE_REQUEST            = fmt.Errorf("error: connection closed before the request was complete")
+	ERROR_MALFORMED_REQUEST_LINE        = fmt.Errorf("error: request line items malformed")
+	ERROR_INVALID_METHOD                = fmt.Errorf("error: regex failed for method")
+	ERROR_UNSUPPORTED_HTTP_VERSION      = fmt.Errorf("error: only http/1.1 is supported")
+	ERROR_HEADER_TOO_LARGE              = fmt.Errorf("error: request line and headers are too large")
+	ERROR_INVALID_CONTENT_LENGTH        = fmt.Errorf("error: invalid content-length")
+	ERROR_BODY_TOO_LARGE                = fmt.Errorf("error: request body is larger than allowed")
+	ERROR_MALFORMED_CHUNK               = fmt.Errorf("error: malformed chunk")
+	ERROR_UNSUPPORTED_TRANSFER_ENCODING = fmt.Errorf("error: unsupported transfer-encoding")
+	// a message framed both ways, or by different lengths, is read differently by different
+	// parsers which lets a client smuggle a request past a proxy, see RFC 9112 section 6.3
+	ERROR_CONFLICTING_CONTENT_LENGTH            = fmt.Errorf("error: repeated or conflicting content-length values")
+	ERROR_CONTENT_LENGTH_WITH_TRANSFER_ENCODING = fmt.Errorf("error: content-length together with transfer-encoding")
+
+	methodRe = regexp.MustCompile("^[A-Z]+$")
 )
 
 const (
@@ -35,95 +83,267 @@ const (
 	REQUEST_STATE_PARSING_BODY    = 2
 	REQUEST_STATE_DONE            = 3
 	SEPARATOR                     = "\r\n"
+	// MAX_HEADER_SIZE limits the request line and headers, and separately the trailers
+	MAX_HEADER_SIZE       = 64 * 1024
+	DEFAULT_MAX_BODY_SIZE = 10 * 1024 * 1024
+	// maxEmptyReads is how many reads returning nothing are tolerated before giving up on a reader
+	maxEmptyReads = 100
 )
 
-func RequestFromReader(reader io.Reader) (*Request, error) {
+func RequestFromReader(reader io.Reader, options ...ParseOption) (*Request, error) {
+	request, err := RequestHeadFromReader(reader, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := request.ReadBody(); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// RequestHeadFromReader parses the request line and the headers, leaving the body
+// unread until ReadBody is called
+func RequestHeadFromReader(reader io.Reader, options ...ParseOption) (*Request, error) {
+	parser := &requestParser{
+		requestData:              make([]byte, 8),
+		contentLengthHeaderValue: -1,
+	}
+	for _, option := range options {
+		option(parser)
+	}
+	parser.lineEndings = &lineEndingReader{reader: reader, leniency: parser.leniency}
+	parser.reader = parser.lineEndings
 
-	bytesRead = 0
-	bytesParsed = 0
-	requestData = make([]byte, 8)
-	contentLengthHeaderValue = -1
 	request := &Request{
-		State:   REQUEST_STATE_INITIALIZED,
-		Headers: headers.Headers{},
-		Body:    make([]byte, 0),
+		State:    REQUEST_STATE_INITIALIZED,
+		Headers:  headers.Headers{},
+		Body:     make([]byte, 0),
+		Trailers: headers.Headers{},
+		parser:   parser,
+	}
+
+	if err := request.readUntil(REQUEST_STATE_PARSING_BODY); err != nil {
+		return nil, err
+	}
+
+	if parser.lineEndings.rewroteLF {
+		request.deviate(DEVIATION_BARE_LF)
+	}
+	if parser.lineEndings.unfolded {
+		request.deviate(DEVIATION_OBS_FOLD)
+	}
+	if parser.uppercasedMethod {
+		request.deviate(DEVIATION_LOWERCASE_METHOD)
+	}
+
+	return request, nil
+}
+
+// ReadBody reads the body announced by the headers into Body, decoding it when
+// MaxDecodedBodySize is set. Calling it again once the body was read does nothing.
+func (r *Request) ReadBody() error {
+	if r.parser == nil || r.State == REQUEST_STATE_DONE {
+		return nil
+	}
+
+	if !r.parser.chunked && int64(r.parser.contentLengthHeaderValue) > r.maxBodySize() {
+		return ERROR_BODY_TOO_LARGE
+	}
+	if err := r.readUntil(REQUEST_STATE_DONE); err != nil {
+		return err
+	}
+
+	if r.MaxDecodedBodySize > 0 {
+		return r.DecodeBody(r.MaxDecodedBodySize)
+	}
+
+	return nil
+}
+
+// bodyStream reads the body as it arrives from the client, handing out and dropping what is
+// parsed into Body instead of collecting it. MaxBodySize only limits single chunks of a chunked
+// body then. err keeps the error reading the client failed with.
+type bodyStream struct {
+	request *Request
+	err     error
+}
+
+// bodyStream returns a reader of the rest of the body, what was already read into Body included
+func (r *Request) bodyStream() *bodyStream {
+	if r.parser != nil {
+		r.parser.streaming = true
+	}
+
+	return &bodyStream{request: r}
+}
+
+func (s *bodyStream) Read(p []byte) (int, error) {
+	r := s.request
+	if s.err != nil {
+		return 0, s.err
+	}
+	if len(r.Body) == 0 && r.parser != nil && r.State != REQUEST_STATE_DONE {
+		s.err = r.readWhile(func() bool { return len(r.Body) == 0 && r.State != REQUEST_STATE_DONE })
+		if s.err != nil {
+			return 0, s.err
+		}
+	}
+	if len(r.Body) == 0 {
+		return 0, io.EOF
 	}
 
-	isEOF := false
+	n := copy(p, r.Body)
+	r.Body = r.Body[n:]
+
+	return n, nil
+}
+
+// Buffered returns the bytes read from the client that are not part of the parsed request yet,
+// e.g. the first frames of the protocol a hijacked connection switches to
+func (r *Request) Buffered() []byte {
+	if r.parser == nil {
+		return nil
+	}
+
+	buffered := bytes.Clone(r.parser.requestData[:r.parser.bytesRead])
+
+	return append(buffered, r.parser.lineEndings.pending...)
+}
+
+func (r *Request) maxBodySize() int64 {
+	if r.MaxBodySize > 0 {
+		return r.MaxBodySize
+	}
+
+	return DEFAULT_MAX_BODY_SIZE
+}
+
+// readUntil reads from the client until the request reached state
+func (r *Request) readUntil(state int) error {
+	return r.readWhile(func() bool { return r.State < state })
+}
+
+// readWhile reads from the client and parses what it got as long as more returns true
+func (r *Request) readWhile(more func() bool) error {
+	p := r.parser
+	emptyReads := 0
 
 	for {
-		data := make([]byte, 8)
-		n, err := reader.Read(data)
-		if err != nil {
-			if err != io.EOF {
-				return nil, err
+		// a single read can hold more than one part of the request, keep parsing what is
+		// buffered instead of waiting for data the client might never send
+		for more() {
+			previousState := r.State
+			parse, err := r.parse([]byte{})
+			if err != nil {
+				return err
+			}
+			if parse == 0 && r.State == previousState {
+				break
 			}
-			//isEOF = true
-		}
 
-		bytesRead += n
+			p.bytesParsed = parse
+			if parse != 0 {
+				p.moveRemainingBytesToRequestData()
+			}
+		}
 
-		parse, err := request.parse(data[:n])
-		if err != nil {
-			return nil, err
+		if !more() {
+			return nil
 		}
 
-		bytesParsed = parse
-		if parse != 0 {
-			moveRemainingBytesToRequestData()
+		// everything buffered is part of the unfinished head, which would otherwise grow without bound
+		if r.State < REQUEST_STATE_PARSING_BODY && p.headBytes+p.bytesRead >= MAX_HEADER_SIZE {
+			return ERROR_HEADER_TOO_LARGE
 		}
 
-		if request.State == REQUEST_STATE_DONE || isEOF {
-			break
+		if p.bytesRead >= len(p.requestData) {
+			p.allocateSpaceForRequestData()
 		}
-	}
+		n, err := p.reader.Read(p.requestData[p.bytesRead:])
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 && err == io.EOF {
+			return ERROR_INCOMPLETE_REQUEST
+		}
+		if n == 0 {
+			if emptyReads++; emptyReads >= maxEmptyReads {
+				return io.ErrNoProgress
+			}
+			continue
+		}
+		emptyReads = 0
 
-	return request, nil
+		p.bytesRead += n
+	}
 }
 
 func (r *Request) parse(data []byte) (int, error) {
+	p := r.parser
 
-	if bytesRead >= len(requestData) {
-		allocateSpaceForRequestData()
+	if p.bytesRead >= len(p.requestData) {
+		p.allocateSpaceForRequestData()
 	}
-	moveReadDataToRequestData(data)
-
-	parsedBytes, err := parseRequestLine(requestData)
-	if err != nil {
-		return 0, err
+	p.moveReadDataToRequestData(data)
+	buffered := p.requestData[:p.bytesRead]
+
+	// only the head is made of lines, looking for one in a large body would be quadratic
+	var err error
+	parsedBytes := 0
+	if r.State < REQUEST_STATE_PARSING_BODY {
+		if parsedBytes, err = p.parseRequestLine(buffered); err != nil {
+			return 0, err
+		}
 	}
 
 	if parsedBytes != 0 || r.State == REQUEST_STATE_PARSING_BODY {
 		switch r.State {
 		case REQUEST_STATE_INITIALIZED:
-			requestLine, err := getRequestLineObjectFromRequestData(parsedBytes)
+			requestLine, err := p.getRequestLineObjectFromRequestData(parsedBytes)
 
 			if err != nil {
 				return 0, err
 			}
 
 			r.RequestLine = *requestLine
+			p.headBytes += parsedBytes
 
 			r.State = REQUEST_STATE_PARSING_HEADERS
 
 			break
 		case REQUEST_STATE_PARSING_HEADERS:
-			bytesParsedHeader, isDone, err := r.Headers.Parse(requestData)
+			bytesParsedHeader, isDone, err := r.Headers.Parse(buffered)
 			if err != nil {
 				return 0, err
 			}
 			parsedBytes = bytesParsedHeader
+			p.headBytes += parsedBytes
 
-			if isDone || strings.Contains(string(requestData), fmt.Sprintf("%s%s", SEPARATOR, SEPARATOR)) {
+			if isDone || bytes.HasPrefix(buffered[parsedBytes:], []byte(SEPARATOR)) {
+				// the empty line ending the headers is not part of the body
+				parsedBytes += len(SEPARATOR)
 				r.State = REQUEST_STATE_PARSING_BODY
 
-				value, err := r.Headers.GetHeaderValue("content-length")
-				if err != nil {
+				// requests can only be chunked, and a request without framing headers has no body
+				value, hasContentLength := r.Headers["content-length"]
+				if transferEncoding, ok := r.Headers["transfer-encoding"]; ok {
+					if hasContentLength {
+						return 0, ERROR_CONTENT_LENGTH_WITH_TRANSFER_ENCODING
+					}
+					if !strings.EqualFold(strings.TrimSpace(transferEncoding), "chunked") {
+						return 0, ERROR_UNSUPPORTED_TRANSFER_ENCODING
+					}
+					p.chunked = true
+					break
+				}
+				if !hasContentLength {
 					r.State = REQUEST_STATE_DONE
 					break
 				}
 
-				contentLengthHeaderValue, err = strconv.Atoi(value)
+				p.contentLengthHeaderValue, err = parseContentLengthField(value)
 				if err != nil {
 					return 0, err
 				}
@@ -131,13 +351,18 @@ func (r *Request) parse(data []byte) (int, error) {
 			}
 			break
 		case REQUEST_STATE_PARSING_BODY:
-			r.Body = append(r.Body, requestData[:bytesRead]...)
-			parsedBytes = bytesRead
-
-			if len(r.Body) > contentLengthHeaderValue {
-				return 0, fmt.Errorf("error: body length is larger than content lenght")
+			if p.chunked {
+				parsedBytes, err = r.parseChunk(buffered)
+				break
 			}
-			if len(r.Body) == contentLengthHeaderValue {
+
+			// bytes past Content-Length belong to whatever the client sends next, see Buffered
+			bodyBytes := min(p.contentLengthHeaderValue-p.bodyParsed, p.bytesRead)
+			r.Body = append(r.Body, p.requestData[:bodyBytes]...)
+			p.bodyParsed += bodyBytes
+			parsedBytes = bodyBytes
+
+			if p.bodyParsed == p.contentLengthHeaderValue {
 				r.State = REQUEST_STATE_DONE
 			}
 		default:
@@ -149,62 +374,163 @@ func (r *Request) parse(data []byte) (int, error) {
 	return parsedBytes, err
 }
 
-func parseRequestLine(requestBytes []byte) (int, error) {
-	requestString := string(requestBytes)
+// parseChunk consumes the next chunk of a chunked body, or the last chunk and the trailer
+// section, returning 0 until it is completely buffered
+func (r *Request) parseChunk(data []byte) (int, error) {
+	sizeEnd := bytes.Index(data, []byte(SEPARATOR))
+	if sizeEnd == -1 {
+		if len(data) > MAX_HEADER_SIZE {
+			return 0, ERROR_MALFORMED_CHUNK
+		}
+		return 0, nil
+	}
+	// chunk extensions are ignored
+	sizeText, _, _ := strings.Cut(string(data[:sizeEnd]), ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeText), 16, 64)
+	if err != nil || size < 0 || sizeText == "" || strings.ContainsAny(sizeText, "+-") {
+		return 0, ERROR_MALFORMED_CHUNK
+	}
+	// a streamed body is not held at once, but every chunk is
+	maxSize := r.maxBodySize()
+	if !r.parser.streaming {
+		maxSize -= int64(r.parser.bodyParsed)
+	}
+	if size > maxSize {
+		return 0, ERROR_BODY_TOO_LARGE
+	}
+	start := sizeEnd + len(SEPARATOR)
+
+	if size == 0 {
+		if bytes.HasPrefix(data[start:], []byte(SEPARATOR)) {
+			r.State = REQUEST_STATE_DONE
+			return start + len(SEPARATOR), nil
+		}
+		trailersEnd := bytes.Index(data[start:], []byte(SEPARATOR+SEPARATOR))
+		if trailersEnd == -1 {
+			if len(data)-start > MAX_HEADER_SIZE {
+				return 0, ERROR_HEADER_TOO_LARGE
+			}
+			return 0, nil
+		}
+		if _, _, err := r.Trailers.Parse(data[start : start+trailersEnd+len(SEPARATOR)]); err != nil {
+			return 0, err
+		}
+		r.State = REQUEST_STATE_DONE
+		return start + trailersEnd + 2*len(SEPARATOR), nil
+	}
 
-	if !strings.Contains(requestString, SEPARATOR) {
+	if size > int64(len(data)-start-len(SEPARATOR)) {
 		return 0, nil
 	}
+	end := start + int(size)
+	if string(data[end:end+len(SEPARATOR)]) != SEPARATOR {
+		return 0, ERROR_MALFORMED_CHUNK
+	}
+	r.Body = append(r.Body, data[start:end]...)
+	r.parser.bodyParsed += int(size)
+
+	return end + len(SEPARATOR), nil
+}
+
+// parseContentLength accepts the digits of a single non-negative length, see RFC 9110 section 8.6
+func parseContentLength(value string) (int, error) {
+	if value == "" || len(value) > 18 {
+		return 0, ERROR_INVALID_CONTENT_LENGTH
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return 0, ERROR_INVALID_CONTENT_LENGTH
+		}
+	}
+
+	return strconv.Atoi(value)
+}
 
-	finishRequestLine := strings.Index(requestString, SEPARATOR)
-	return len(requestBytes[:finishRequestLine]) + len(SEPARATOR), nil
+// parseContentLengthField parses the Content-Length of a request. Headers.Parse joins repeated
+// fields into a list, which is refused like a single field listing several lengths, empty
+// fields included, as parsers disagreeing on the length is what request smuggling relies on.
+func parseContentLengthField(value string) (int, error) {
+	if strings.Contains(value, ",") {
+		return 0, ERROR_CONFLICTING_CONTENT_LENGTH
+	}
 
+	return parseContentLength(strings.TrimSpace(value))
 }
 
-func allocateSpaceForRequestData() {
-	aux := make([]byte, bytesRead)
-	_ = copy(aux, requestData)
-	requestData = make([]byte, bytesRead*2)
-	_ = copy(requestData, aux)
+// IsChunked reports whether chunked is the last coding of a Transfer-Encoding value
+func IsChunked(transferEncoding string) bool {
+	codings := strings.Split(transferEncoding, ",")
+
+	return strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked")
 }
 
-func moveReadDataToRequestData(data []byte) {
+// parseRequestLine returns the length of the first line of requestBytes, 0 while it is not
+// complete. Only the bytes appended since the last search are scanned, a CRLF split across
+// two reads included.
+func (p *requestParser) parseRequestLine(requestBytes []byte) (int, error) {
+	start := max(p.lineSearched-len(SEPARATOR)+1, 0)
+	finishRequestLine := bytes.Index(requestBytes[start:], []byte(SEPARATOR))
+	if finishRequestLine == -1 {
+		p.lineSearched = len(requestBytes)
+		return 0, nil
+	}
+
+	p.lineSearched = 0
+	return start + finishRequestLine + len(SEPARATOR), nil
+}
+
+func (p *requestParser) allocateSpaceForRequestData() {
+	aux := make([]byte, p.bytesRead)
+	_ = copy(aux, p.requestData)
+	p.requestData = make([]byte, p.bytesRead*2)
+	_ = copy(p.requestData, aux)
+}
+
+func (p *requestParser) moveReadDataToRequestData(data []byte) {
 	count := 0
-	for i := bytesRead - len(data); i < bytesRead; i++ {
-		requestData[i] = data[count]
+	for i := p.bytesRead - len(data); i < p.bytesRead; i++ {
+		p.requestData[i] = data[count]
 		count += 1
 	}
 }
 
-func getRequestLineObjectFromRequestData(parsedBytes int) (*RequestLine, error) {
+func (p *requestParser) getRequestLineObjectFromRequestData(parsedBytes int) (*RequestLine, error) {
 
-	requestLineString := string(requestData[:parsedBytes])
+	requestLineString := strings.TrimSuffix(string(p.requestData[:parsedBytes]), SEPARATOR)
 
 	requestLineItems := strings.Split(requestLineString, " ")
-	if len(requestLineItems) != 3 {
-		return nil, fmt.Errorf("error: request line items malformed")
+	if len(requestLineItems) != 3 || requestLineItems[1] == "" || strings.ContainsFunc(requestLineItems[1], isControl) {
+		return nil, ERROR_MALFORMED_REQUEST_LINE
 	}
-	if expValue, err := regexp.MatchString("[A-Z]+", requestLineItems[0]); !expValue || err != nil {
-		return nil, fmt.Errorf("error: regex failed for method")
+	method := requestLineItems[0]
+	if !methodRe.MatchString(method) {
+		if !p.leniency.LowercaseMethods || !lenientMethodRe.MatchString(method) {
+			return nil, ERROR_INVALID_METHOD
+		}
+		method = strings.ToUpper(method)
+		p.uppercasedMethod = true
 	}
-	if !strings.Contains(requestLineItems[2], "HTTP/1.1") {
-		return nil, fmt.Errorf("error: only http/1.1 is supported")
+	if requestLineItems[2] != "HTTP/1.1" {
+		return nil, ERROR_UNSUPPORTED_HTTP_VERSION
 	}
 
 	return &RequestLine{
-		Method:        requestLineItems[0],
+		Method:        method,
 		RequestTarget: requestLineItems[1],
 		HttpVersion:   strings.Split(requestLineItems[2], "/")[1],
 	}, nil
 
 }
 
-func moveRemainingBytesToRequestData() {
-	remainingBytes := make([]byte, len(requestData[bytesParsed:bytesRead]))
-	_ = copy(remainingBytes, requestData[bytesParsed:bytesRead])
-	clear(requestData)
-	bytesRead = len(remainingBytes)
-	copy(requestData, remainingBytes)
+func (p *requestParser) moveRemainingBytesToRequestData() {
+	remaining := copy(p.requestData, p.requestData[p.bytesParsed:p.bytesRead])
+	clear(p.requestData[remaining:p.bytesRead])
+	p.bytesRead = remaining
+	p.lineSearched = 0
+}
+
+func isControl(r rune) bool {
+	return r < ' ' || r == 0x7f
 }
 
 func (r *Request) isRequestBodySizeEqualToContentLength() (bool, error) {
@@ -3,7 +3,9 @@ package request
 import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"httpfromtcp/internal/headers"
 	"io"
+	"strings"
 	"testing"
 )
 
@@ -53,6 +55,17 @@ func TestRequestLineParse(t *testing.T) {
 	assert.Equal(t, "GET", r.RequestLine.Method)
 	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
 	assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
+
+	// Test: Only new bytes are searched for the end of the line, a CRLF split across reads included
+	p := &requestParser{}
+	n, err := p.parseRequestLine([]byte("GET / HTTP/1.1\r"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 15, p.lineSearched)
+	n, err = p.parseRequestLine([]byte("GET / HTTP/1.1\r\nHost"))
+	require.NoError(t, err)
+	assert.Equal(t, 16, n)
+	assert.Equal(t, 0, p.lineSearched)
 }
 
 func TestRequestHeadersParse(t *testing.T) {
@@ -129,7 +142,7 @@ func TestRequestBodyParse(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, r)
 
-	// Test: No Content-Length but Body Exists
+	// Test: No Content-Length but Body Exists, a request without framing headers has no body
 	reader = &chunkReader{
 		data: "POST /submit HTTP/1.1\r\n" +
 			"Host: localhost:42069\r\n" +
@@ -140,5 +153,264 @@ func TestRequestBodyParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
+	assert.Empty(t, r.Body)
+}
+
+func TestRequestHeadFromReader(t *testing.T) {
+	// Test: Body is left unread until ReadBody
+	reader := &chunkReader{
+		data:            "POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 13\r\n\r\nhello world!\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestHeadFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, REQUEST_STATE_PARSING_BODY, r.State)
+	assert.Equal(t, "13", r.Headers["content-length"])
+	assert.Empty(t, r.Body)
+	require.NoError(t, r.ReadBody())
+	assert.Equal(t, REQUEST_STATE_DONE, r.State)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	require.NoError(t, r.ReadBody())
+	assert.Equal(t, "hello world!\n", string(r.Body))
+
+	// Test: Requests without a body are done after the headers
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err = RequestHeadFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, REQUEST_STATE_DONE, r.State)
+
+	// Test: Truncated body
+	reader = &chunkReader{
+		data:            "POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 20\r\n\r\nhello",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestHeadFromReader(reader)
+	require.NoError(t, err)
+	assert.ErrorIs(t, r.ReadBody(), ERROR_INCOMPLETE_REQUEST)
+}
+
+func TestRequestChunkedBody(t *testing.T) {
+	// Test: Chunks with extensions and trailers
+	reader := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"6\r\nhello \r\n7;name=value\r\nworld!\n\r\n0\r\nX-Checksum: abc\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
 	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, "abc", r.Trailers.Get("x-checksum"))
+
+	// Test: Nothing is left over after the last chunk
+	reader = &chunkReader{
+		data:            "POST /upload HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nok\r\n0\r\n\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(r.Body))
+	assert.Empty(t, r.Buffered())
+
+	// Test: Malformed chunk size and missing chunk terminator
+	for _, chunks := range []string{"zz\r\nok\r\n0\r\n\r\n", "2\r\nokay\r\n0\r\n\r\n"} {
+		reader = &chunkReader{
+			data:            "POST /upload HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" + chunks,
+			numBytesPerRead: 4,
+		}
+		_, err = RequestFromReader(reader)
+		assert.ErrorIs(t, err, ERROR_MALFORMED_CHUNK, chunks)
+	}
+
+	// Test: Transfer codings other than chunked can not be framed
+	for _, transferEncoding := range []string{"gzip", "gzip, chunked", "chunked, chunked"} {
+		reader = &chunkReader{
+			data:            "POST /upload HTTP/1.1\r\nTransfer-Encoding: " + transferEncoding + "\r\n\r\n",
+			numBytesPerRead: 4,
+		}
+		_, err = RequestFromReader(reader)
+		assert.ErrorIs(t, err, ERROR_UNSUPPORTED_TRANSFER_ENCODING, transferEncoding)
+	}
+
+	// Test: Connection closed before the last chunk
+	reader = &chunkReader{
+		data:            "POST /upload HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nok\r\n",
+		numBytesPerRead: 4,
+	}
+	_, err = RequestFromReader(reader)
+	assert.ErrorIs(t, err, ERROR_INCOMPLETE_REQUEST)
+}
+
+func TestRequestLimits(t *testing.T) {
+	// Test: Typed errors for malformed request lines
+	for requestLine, expected := range map[string]error{
+		"GET /coffee":               ERROR_MALFORMED_REQUEST_LINE,
+		"GET  HTTP/1.1":             ERROR_MALFORMED_REQUEST_LINE,
+		"GET /cof\x01fee HTTP/1.1":  ERROR_MALFORMED_REQUEST_LINE,
+		"gET /coffee HTTP/1.1":      ERROR_INVALID_METHOD,
+		"GET /coffee HTTP/1.0":      ERROR_UNSUPPORTED_HTTP_VERSION,
+		"GET /coffee xHTTP/1.1x":    ERROR_UNSUPPORTED_HTTP_VERSION,
+		"GET /coffee HTTP/1.1 more": ERROR_MALFORMED_REQUEST_LINE,
+	} {
+		reader := &chunkReader{data: requestLine + "\r\nHost: localhost:42069\r\n\r\n", numBytesPerRead: 3}
+		_, err := RequestFromReader(reader)
+		assert.ErrorIs(t, err, expected, requestLine)
+	}
+
+	// Test: Content-Length has to be a single non-negative number
+	for _, contentLength := range []string{"-1", "+5", "5 5", "0x10", "99999999999999999999"} {
+		reader := &chunkReader{
+			data:            "POST /submit HTTP/1.1\r\nContent-Length: " + contentLength + "\r\n\r\nhello",
+			numBytesPerRead: 3,
+		}
+		_, err := RequestFromReader(reader)
+		assert.ErrorIs(t, err, ERROR_INVALID_CONTENT_LENGTH, contentLength)
+	}
+
+	// Test: Endless headers
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("a", MAX_HEADER_SIZE),
+		numBytesPerRead: 1024,
+	}
+	_, err := RequestFromReader(reader)
+	assert.ErrorIs(t, err, ERROR_HEADER_TOO_LARGE)
+
+	// Test: Bodies larger than MaxBodySize are refused before they are read
+	r, err := RequestHeadFromReader(&chunkReader{
+		data:            "POST /submit HTTP/1.1\r\nContent-Length: 13\r\n\r\nhello world!\n",
+		numBytesPerRead: 3,
+	})
+	require.NoError(t, err)
+	r.MaxBodySize = 12
+	assert.ErrorIs(t, r.ReadBody(), ERROR_BODY_TOO_LARGE)
+	assert.Empty(t, r.Body)
+
+	// Test: Chunks adding up to more than MaxBodySize
+	r, err = RequestHeadFromReader(&chunkReader{
+		data:            "POST /upload HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n8\r\n12345678\r\n8\r\n12345678\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.NoError(t, err)
+	r.MaxBodySize = 12
+	assert.ErrorIs(t, r.ReadBody(), ERROR_BODY_TOO_LARGE)
+
+	// Test: Readers that never return data
+	_, err = RequestFromReader(&chunkReader{data: "GET / HTTP/1.1\r\n", numBytesPerRead: 0})
+	assert.ErrorIs(t, err, io.ErrNoProgress)
+}
+
+func TestRequestSmuggling(t *testing.T) {
+	// Test: Repeated, empty and differing Content-Length values
+	for _, head := range []string{
+		"Content-Length: 5\r\nContent-Length: 5\r\n",
+		"Content-Length: 5\r\nContent-Length: 6\r\n",
+		"Content-Length: 5, 6\r\n",
+		"Content-Length:\r\nContent-Length: 5\r\n",
+		"Content-Length: 5\r\nContent-Length:\r\n",
+	} {
+		reader := &chunkReader{data: "POST /submit HTTP/1.1\r\n" + head + "\r\nhello!", numBytesPerRead: 3}
+		_, err := RequestFromReader(reader)
+		assert.ErrorIs(t, err, ERROR_CONFLICTING_CONTENT_LENGTH, head)
+	}
+	_, err := RequestFromReader(&chunkReader{data: "POST /submit HTTP/1.1\r\nContent-Length:\r\n\r\nhello", numBytesPerRead: 3})
+	assert.ErrorIs(t, err, ERROR_INVALID_CONTENT_LENGTH)
+
+	// Test: Repeated and empty Transfer-Encoding values
+	for _, head := range []string{
+		"Transfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n",
+		"Transfer-Encoding:\r\nTransfer-Encoding: chunked\r\n",
+		"Transfer-Encoding:\r\n",
+	} {
+		reader := &chunkReader{data: "POST /submit HTTP/1.1\r\n" + head + "\r\n0\r\n\r\n", numBytesPerRead: 3}
+		_, err = RequestFromReader(reader)
+		assert.ErrorIs(t, err, ERROR_UNSUPPORTED_TRANSFER_ENCODING, head)
+	}
+
+	// Test: Content-Length together with Transfer-Encoding
+	reader := &chunkReader{
+		data:            "POST /upload HTTP/1.1\r\nContent-Length: 7\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nok\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	assert.ErrorIs(t, err, ERROR_CONTENT_LENGTH_WITH_TRANSFER_ENCODING)
+
+	// Test: Folded headers and whitespace before the colon
+	for head, expected := range map[string]error{
+		"Host: localhost\r\n :42069\r\n":  headers.ERROR_OBS_FOLD,
+		"Transfer-Encoding : chunked\r\n": headers.ERROR_WHITESPACE_BEFORE_COLON,
+		"Content-Length\t: 5\r\n":         headers.ERROR_WHITESPACE_BEFORE_COLON,
+	} {
+		reader = &chunkReader{data: "POST /submit HTTP/1.1\r\n" + head + "\r\nhello", numBytesPerRead: 3}
+		_, err = RequestFromReader(reader)
+		assert.ErrorIs(t, err, expected, head)
+	}
+
+	// Test: Bare LF line endings
+	for _, data := range []string{
+		"GET / HTTP/1.1\nHost: localhost\r\n\r\n",
+		"GET / HTTP/1.1\r\nHost: localhost\n\r\n",
+		"GET / HTTP/1.1\r\nHost: localhost\r\n\n",
+	} {
+		_, err = RequestFromReader(&chunkReader{data: data, numBytesPerRead: 3})
+		assert.ErrorIs(t, err, ERROR_BARE_LF, data)
+	}
+
+	// Test: Bare LF line endings when allowed, the body is not rewritten
+	for _, numBytesPerRead := range []int{1, 4, 1024} {
+		reader = &chunkReader{
+			data:            "POST /submit HTTP/1.1\nHost: localhost\r\nContent-Length: 4\n\na\nb\n",
+			numBytesPerRead: numBytesPerRead,
+		}
+		r, err := RequestFromReader(reader, WithBareLF())
+		require.NoError(t, err)
+		assert.Equal(t, "localhost", r.Headers.Get("host"))
+		assert.Equal(t, "a\nb\n", string(r.Body))
+	}
+
+	// Test: Rewritten bytes that did not fit the read buffer are still buffered
+	r, err := RequestHeadFromReader(strings.NewReader("GET / HTTP/1.1\nHost: localhost\n\nnext"), WithBareLF())
+	require.NoError(t, err)
+	assert.Equal(t, "next", string(r.Buffered()))
+}
+
+func TestRequestLeniency(t *testing.T) {
+	head := "post /submit HTTP/1.1\nHost: localhost\r\nX-Folded: one\r\n  \ttwo\n\tthree\r\nContent-Length: 4\n\r\na\nb\n"
+
+	// Test: Deviations are rejected by default
+	_, err := RequestFromReader(&chunkReader{data: head, numBytesPerRead: 3})
+	assert.ErrorIs(t, err, ERROR_BARE_LF)
+	crlf := strings.ReplaceAll(strings.ReplaceAll(head, "\r\n", "\n"), "\n", "\r\n")
+	_, err = RequestFromReader(&chunkReader{data: crlf, numBytesPerRead: 3})
+	assert.ErrorIs(t, err, ERROR_INVALID_METHOD)
+	_, err = RequestFromReader(&chunkReader{data: "POST" + crlf[4:], numBytesPerRead: 3})
+	assert.ErrorIs(t, err, headers.ERROR_OBS_FOLD)
+
+	// Test: Deviations are normalised and counted once per request
+	counters := &LeniencyCounters{}
+	leniency := Leniency{BareLF: true, ObsFold: true, LowercaseMethods: true, Counters: counters}
+	for _, numBytesPerRead := range []int{1, 3, 1024} {
+		r, err := RequestFromReader(&chunkReader{data: head, numBytesPerRead: numBytesPerRead}, WithLeniency(leniency))
+		require.NoError(t, err)
+		assert.Equal(t, "POST", r.RequestLine.Method)
+		assert.Equal(t, "one two three", r.Headers.Get("x-folded"))
+		assert.Equal(t, "a\nb\n", string(r.Body))
+		assert.Equal(t, []Deviation{DEVIATION_BARE_LF, DEVIATION_OBS_FOLD, DEVIATION_LOWERCASE_METHOD}, r.Deviations)
+	}
+	assert.Equal(t, int64(3), counters.Count(DEVIATION_BARE_LF))
+	assert.Equal(t, int64(3), counters.Count(DEVIATION_OBS_FOLD))
+	assert.Equal(t, int64(3), counters.Count(DEVIATION_LOWERCASE_METHOD))
+
+	// Test: Only the enabled deviations are accepted
+	_, err = RequestFromReader(&chunkReader{data: head, numBytesPerRead: 3}, WithLeniency(Leniency{BareLF: true, ObsFold: true}))
+	assert.ErrorIs(t, err, ERROR_INVALID_METHOD)
+	_, err = RequestFromReader(&chunkReader{data: "gét / HTTP/1.1\r\n\r\n", numBytesPerRead: 3}, WithLeniency(leniency))
+	assert.ErrorIs(t, err, ERROR_INVALID_METHOD)
+
+	// Test: Strict requests have no deviations
+	r, err := RequestFromReader(&chunkReader{data: "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n", numBytesPerRead: 3}, WithLeniency(leniency))
+	require.NoError(t, err)
+	assert.Empty(t, r.Deviations)
+	assert.Equal(t, int64(3), counters.Count(DEVIATION_BARE_LF))
 }
@@ -0,0 +1,83 @@
+package request
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"httpfromtcp/internal/headers"
+)
+
+var (
+	ERROR_MISSING_REQUEST_LINE = fmt.Errorf("error: request line can not be written")
+)
+
+// Write sends r in HTTP/1.1 form. The body is chunked, followed by the trailers, when the
+// Transfer-Encoding header asks for it and framed by Content-Length otherwise, replacing the
+// framing headers that do not match the body. Header fields are written in sorted order.
+// Nothing is written when a field or the request line would split the request, see
+// headers.Headers.Validate.
+func (r *Request) Write(w io.Writer) error {
+	if r.RequestLine.Method == "" || r.RequestLine.RequestTarget == "" {
+		return ERROR_MISSING_REQUEST_LINE
+	}
+	if !methodRe.MatchString(r.RequestLine.Method) || strings.ContainsFunc(r.RequestLine.RequestTarget, isControl) ||
+		strings.Contains(r.RequestLine.RequestTarget, " ") {
+		return ERROR_MALFORMED_REQUEST_LINE
+	}
+	if err := r.Headers.Validate(); err != nil {
+		return err
+	}
+	if err := r.Trailers.Validate(); err != nil {
+		return err
+	}
+	version := r.RequestLine.HttpVersion
+	if version == "" {
+		version = "1.1"
+	}
+
+	requestHeaders := headers.Headers{}
+	for name, value := range r.Headers {
+		requestHeaders.Set(name, value)
+	}
+	chunked := IsChunked(requestHeaders.Get("transfer-encoding"))
+	if chunked {
+		requestHeaders.Delete("content-length")
+	} else {
+		requestHeaders.Delete("transfer-encoding")
+		if len(r.Body) > 0 || requestHeaders.Get("content-length") != "" {
+			requestHeaders.Set("content-length", strconv.Itoa(len(r.Body)))
+		}
+	}
+
+	writer := bufio.NewWriter(w)
+	fmt.Fprintf(writer, "%s %s HTTP/%s%s", r.RequestLine.Method, r.RequestLine.RequestTarget, version, SEPARATOR)
+	writeFields(writer, requestHeaders)
+
+	if !chunked {
+		writer.Write(r.Body)
+		return writer.Flush()
+	}
+
+	if len(r.Body) > 0 {
+		fmt.Fprintf(writer, "%x%s", len(r.Body), SEPARATOR)
+		writer.Write(r.Body)
+		writer.WriteString(SEPARATOR)
+	}
+	writer.WriteString("0" + SEPARATOR)
+	writeFields(writer, r.Trailers)
+
+	return writer.Flush()
+}
+
+// writeFields writes the header or trailer fields followed by the empty line ending them
+func writeFields(writer *bufio.Writer, fields headers.Headers) {
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		fmt.Fprintf(writer, "%s: %s%s", name, fields[name], SEPARATOR)
+	}
+	writer.WriteString(SEPARATOR)
+}
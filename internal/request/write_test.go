@@ -0,0 +1,108 @@
+package request
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"httpfromtcp/internal/headers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTrip writes r and parses the written bytes back
+func roundTrip(t *testing.T, r *Request) (string, *Request) {
+	buffer := &bytes.Buffer{}
+	require.NoError(t, r.Write(buffer))
+	wire := buffer.String()
+
+	parsed, err := RequestFromReader(&chunkReader{data: wire, numBytesPerRead: 5})
+	require.NoError(t, err)
+
+	return wire, parsed
+}
+
+func TestRequestWrite(t *testing.T) {
+	// Test: Parse, write and parse a request without body
+	r, err := RequestFromReader(&chunkReader{
+		data:            "GET /coffee?size=large HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.NoError(t, err)
+	wire, parsed := roundTrip(t, r)
+	assert.Equal(t, "GET /coffee?size=large HTTP/1.1\r\naccept: */*\r\nhost: localhost:42069\r\nuser-agent: curl/7.81.0\r\n\r\n", wire)
+	assert.Equal(t, r.RequestLine, parsed.RequestLine)
+	assert.Equal(t, r.Headers, parsed.Headers)
+
+	// Test: Content-Length framing
+	r, err = RequestFromReader(&chunkReader{
+		data:            "POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 13\r\n\r\nhello world!\n",
+		numBytesPerRead: 3,
+	})
+	require.NoError(t, err)
+	wire, parsed = roundTrip(t, r)
+	assert.Equal(t, "POST /submit HTTP/1.1\r\ncontent-length: 13\r\nhost: localhost:42069\r\n\r\nhello world!\n", wire)
+	assert.Equal(t, r.Headers, parsed.Headers)
+	assert.Equal(t, r.Body, parsed.Body)
+
+	// Test: Chunked framing keeps the trailers
+	r, err = RequestFromReader(&chunkReader{
+		data:            "PUT /upload HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n4\r\ndefg\r\n0\r\nX-Checksum: 42\r\n\r\n",
+		numBytesPerRead: 2,
+	})
+	require.NoError(t, err)
+	wire, parsed = roundTrip(t, r)
+	assert.Equal(t, "PUT /upload HTTP/1.1\r\nhost: localhost:42069\r\ntransfer-encoding: chunked\r\n\r\n7\r\nabcdefg\r\n0\r\nx-checksum: 42\r\n\r\n", wire)
+	assert.Equal(t, "abcdefg", string(parsed.Body))
+	assert.Equal(t, r.Trailers, parsed.Trailers)
+
+	// Test: Content-Length is fixed up to match the body
+	r = &Request{
+		RequestLine: RequestLine{Method: "POST", RequestTarget: "/submit"},
+		Headers:     map[string]string{"host": "example.com", "content-length": "99", "transfer-encoding": "gzip"},
+		Body:        []byte("data"),
+	}
+	wire, parsed = roundTrip(t, r)
+	assert.Equal(t, "POST /submit HTTP/1.1\r\ncontent-length: 4\r\nhost: example.com\r\n\r\ndata", wire)
+	assert.Equal(t, "data", string(parsed.Body))
+
+	// Test: Empty chunked body
+	r.Headers = map[string]string{"host": "example.com", "transfer-encoding": "chunked"}
+	r.Body = nil
+	wire, parsed = roundTrip(t, r)
+	assert.Equal(t, "POST /submit HTTP/1.1\r\nhost: example.com\r\ntransfer-encoding: chunked\r\n\r\n0\r\n\r\n", wire)
+	assert.Empty(t, parsed.Body)
+
+	// Test: A request line is required
+	assert.ErrorIs(t, (&Request{}).Write(&bytes.Buffer{}), ERROR_MISSING_REQUEST_LINE)
+
+	// Test: Fields that would split the request are refused before anything is written
+	line := RequestLine{Method: "GET", RequestTarget: "/", HttpVersion: "1.1"}
+	for fields, expected := range map[string]error{
+		"x-id: 1\r\nx-injected: 1": headers.ERROR_INVALID_FIELD_VALUE,
+		"x-id: 1\ninjected":        headers.ERROR_INVALID_FIELD_VALUE,
+		"x-id: 1\x00":              headers.ERROR_INVALID_FIELD_VALUE,
+		"x-id\r\ninjected: 1":      headers.ERROR_INVALID_FIELD_NAME,
+		"x id: 1":                  headers.ERROR_INVALID_FIELD_NAME,
+		": 1":                      headers.ERROR_INVALID_FIELD_NAME,
+	} {
+		name, value, _ := strings.Cut(fields, ": ")
+		buffer := &bytes.Buffer{}
+		err = (&Request{RequestLine: line, Headers: headers.Headers{name: value}}).Write(buffer)
+		assert.ErrorIs(t, err, expected, fields)
+		assert.Zero(t, buffer.Len(), fields)
+
+		buffer.Reset()
+		err = (&Request{RequestLine: line, Headers: headers.Headers{"transfer-encoding": "chunked"}, Trailers: headers.Headers{name: value}}).Write(buffer)
+		assert.ErrorIs(t, err, expected, fields)
+		assert.Zero(t, buffer.Len(), fields)
+	}
+
+	// Test: Request lines that would split the request are refused
+	for _, line := range []RequestLine{{Method: "GET", RequestTarget: "/ HTTP/1.1\r\nx-injected: 1\r\n\r\nGET /"}, {Method: "GET /", RequestTarget: "/"}} {
+		buffer := &bytes.Buffer{}
+		assert.ErrorIs(t, (&Request{RequestLine: line}).Write(buffer), ERROR_MALFORMED_REQUEST_LINE, line)
+		assert.Zero(t, buffer.Len())
+	}
+}
@@ -0,0 +1,89 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"httpfromtcp/internal/headers"
+)
+
+// StrongETag identifies content by its SHA-256, for bodies that are fully buffered
+func StrongETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return fmt.Sprintf("\"%s\"", hex.EncodeToString(sum[:16]))
+}
+
+// FileETag identifies a file by its size and modification time without reading it
+func FileETag(size int64, modTime time.Time) string {
+	return fmt.Sprintf("\"%x-%x\"", modTime.UnixNano(), size)
+}
+
+// WeakETag marks etag as weak, meaning the content is equivalent but maybe not byte for byte identical
+func WeakETag(etag string) string {
+	if strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return "W/" + etag
+}
+
+// EvaluatePreconditions applies If-Match, If-Unmodified-Since, If-None-Match and If-Modified-Since
+// in the order of RFC 9110 section 13.2.2. It returns NOT_MODIFIED or PRECONDITION_FAILED when the
+// request must be answered with that status, and OK when it should be processed normally.
+// etag and lastModified describe the current representation and may be empty.
+func EvaluatePreconditions(requestHeaders headers.Headers, method, etag string, lastModified time.Time) StatusCode {
+	lastModified = lastModified.UTC().Truncate(time.Second)
+	isGetOrHead := method == "GET" || method == "HEAD"
+
+	if ifMatch := requestHeaders.Get("if-match"); ifMatch != "" {
+		if !etagListMatches(ifMatch, etag, true) {
+			return PRECONDITION_FAILED
+		}
+	} else if ifUnmodifiedSince := requestHeaders.Get("if-unmodified-since"); ifUnmodifiedSince != "" && !lastModified.IsZero() {
+		date, err := time.Parse(HTTP_DATE_FORMAT, ifUnmodifiedSince)
+		if err == nil && lastModified.After(date) {
+			return PRECONDITION_FAILED
+		}
+	}
+
+	if ifNoneMatch := requestHeaders.Get("if-none-match"); ifNoneMatch != "" {
+		if etagListMatches(ifNoneMatch, etag, false) {
+			if isGetOrHead {
+				return NOT_MODIFIED
+			}
+			return PRECONDITION_FAILED
+		}
+	} else if ifModifiedSince := requestHeaders.Get("if-modified-since"); ifModifiedSince != "" && isGetOrHead && !lastModified.IsZero() {
+		date, err := time.Parse(HTTP_DATE_FORMAT, ifModifiedSince)
+		if err == nil && !lastModified.After(date) {
+			return NOT_MODIFIED
+		}
+	}
+
+	return OK
+}
+
+// etagListMatches compares etag against an If-Match or If-None-Match list,
+// strong comparison treats weak tags as never matching
+func etagListMatches(list, etag string, strong bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return etag != ""
+	}
+	if etag == "" || (strong && strings.HasPrefix(etag, "W/")) {
+		return false
+	}
+
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strong && strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
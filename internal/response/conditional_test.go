@@ -0,0 +1,53 @@
+package response
+
+import (
+	"testing"
+	"time"
+
+	"httpfromtcp/internal/headers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETags(t *testing.T) {
+	assert.Equal(t, StrongETag([]byte("hello")), StrongETag([]byte("hello")))
+	assert.NotEqual(t, StrongETag([]byte("hello")), StrongETag([]byte("hello!")))
+	assert.Equal(t, "\"1-a\"", FileETag(10, time.Unix(0, 1)))
+	assert.Equal(t, "W/\"1-a\"", WeakETag(WeakETag("\"1-a\"")))
+}
+
+func TestEvaluatePreconditions(t *testing.T) {
+	etag := "\"v2\""
+	modified := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	before := "Mon, 03 Mar 2025 05:06:07 GMT"
+	exact := "Tue, 04 Mar 2025 05:06:07 GMT"
+
+	cases := []struct {
+		name     string
+		method   string
+		headers  headers.Headers
+		expected StatusCode
+	}{
+		{"no conditions", "GET", headers.Headers{}, OK},
+		{"if-none-match matches", "GET", headers.Headers{"if-none-match": "\"v1\", \"v2\""}, NOT_MODIFIED},
+		{"if-none-match matches weakly", "GET", headers.Headers{"if-none-match": "W/\"v2\""}, NOT_MODIFIED},
+		{"if-none-match star", "HEAD", headers.Headers{"if-none-match": "*"}, NOT_MODIFIED},
+		{"if-none-match differs", "GET", headers.Headers{"if-none-match": "\"v1\""}, OK},
+		{"if-none-match on unsafe method", "PUT", headers.Headers{"if-none-match": "*"}, PRECONDITION_FAILED},
+		{"if-match matches", "PUT", headers.Headers{"if-match": "\"v2\""}, OK},
+		{"if-match differs", "PUT", headers.Headers{"if-match": "\"v1\""}, PRECONDITION_FAILED},
+		{"if-match is strong", "PUT", headers.Headers{"if-match": "W/\"v2\""}, PRECONDITION_FAILED},
+		{"if-unmodified-since passes", "PUT", headers.Headers{"if-unmodified-since": exact}, OK},
+		{"if-unmodified-since fails", "PUT", headers.Headers{"if-unmodified-since": before}, PRECONDITION_FAILED},
+		{"if-match wins over if-unmodified-since", "PUT", headers.Headers{"if-match": "\"v2\"", "if-unmodified-since": before}, OK},
+		{"if-modified-since not modified", "GET", headers.Headers{"if-modified-since": exact}, NOT_MODIFIED},
+		{"if-modified-since modified", "GET", headers.Headers{"if-modified-since": before}, OK},
+		{"if-modified-since ignored for POST", "POST", headers.Headers{"if-modified-since": exact}, OK},
+		{"if-none-match wins over if-modified-since", "GET", headers.Headers{"if-none-match": "\"v1\"", "if-modified-since": exact}, OK},
+		{"invalid date is ignored", "GET", headers.Headers{"if-modified-since": "yesterday"}, OK},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, EvaluatePreconditions(c.headers, c.method, etag, modified), c.name)
+	}
+}
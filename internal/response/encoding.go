@@ -0,0 +1,88 @@
+package response
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	ENCODING_GZIP     = "gzip"
+	ENCODING_DEFLATE  = "deflate"
+	ENCODING_IDENTITY = "identity"
+)
+
+var (
+	compressibleTypes = []string{
+		"application/javascript",
+		"application/json",
+		"application/xml",
+		"image/svg+xml",
+	}
+)
+
+// NegotiateEncoding picks the content coding from supported, in order of preference, that the
+// Accept-Encoding value accepts with the highest q-value. It returns ENCODING_IDENTITY when
+// none of them is acceptable.
+func NegotiateEncoding(acceptEncoding string, supported []string) string {
+	if strings.TrimSpace(acceptEncoding) == "" {
+		return ENCODING_IDENTITY
+	}
+
+	qualities := map[string]float64{}
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(item, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.ToLower(strings.TrimSpace(name)) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			quality = parsed
+		}
+		qualities[coding] = quality
+	}
+
+	best := ENCODING_IDENTITY
+	bestQuality := 0.0
+	for _, coding := range supported {
+		quality, ok := qualities[coding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best = coding
+			bestQuality = quality
+		}
+	}
+
+	return best
+}
+
+// IsCompressible reports whether content of contentType is worth compressing
+func IsCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	if mediaType == EVENT_STREAM_CONTENT_TYPE {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+	for _, compressibleType := range compressibleTypes {
+		if mediaType == compressibleType {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,33 @@
+package response
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{ENCODING_GZIP, ENCODING_DEFLATE}
+
+	assert.Equal(t, ENCODING_IDENTITY, NegotiateEncoding("", supported))
+	assert.Equal(t, ENCODING_GZIP, NegotiateEncoding("gzip, deflate, br", supported))
+	assert.Equal(t, ENCODING_DEFLATE, NegotiateEncoding("gzip;q=0.5, deflate", supported))
+	assert.Equal(t, ENCODING_DEFLATE, NegotiateEncoding("DEFLATE", supported))
+	assert.Equal(t, ENCODING_GZIP, NegotiateEncoding("*", supported))
+	assert.Equal(t, ENCODING_DEFLATE, NegotiateEncoding("*;q=0.3, gzip;q=0", supported))
+	assert.Equal(t, ENCODING_IDENTITY, NegotiateEncoding("gzip;q=0, deflate;q=0", supported))
+	assert.Equal(t, ENCODING_IDENTITY, NegotiateEncoding("br", supported))
+	assert.Equal(t, ENCODING_IDENTITY, NegotiateEncoding("gzip;q=nope", supported))
+}
+
+func TestIsCompressible(t *testing.T) {
+	assert.True(t, IsCompressible("text/html"))
+	assert.True(t, IsCompressible("text/plain; charset=utf-8"))
+	assert.True(t, IsCompressible("application/json"))
+	assert.True(t, IsCompressible("application/problem+json"))
+	assert.True(t, IsCompressible("image/svg+xml"))
+	assert.False(t, IsCompressible("video/mp4"))
+	assert.False(t, IsCompressible("image/png"))
+	assert.False(t, IsCompressible("text/event-stream"))
+	assert.False(t, IsCompressible(""))
+}
@@ -0,0 +1,139 @@
+package response
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HTTP_DATE_FORMAT = "Mon, 02 Jan 2006 15:04:05 GMT"
+	maxRanges        = 100
+)
+
+var (
+	ERROR_INVALID_RANGE         = fmt.Errorf("error: invalid range")
+	ERROR_RANGE_NOT_SATISFIABLE = fmt.Errorf("error: range not satisfiable")
+)
+
+// ByteRange is a part of a representation selected by a Range header
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange returns the Content-Range value for r in a representation of size bytes
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range header (RFC 9110 section 14.2) for a representation of size bytes.
+// ERROR_INVALID_RANGE means the header should be ignored and the full representation sent,
+// ERROR_RANGE_NOT_SATISFIABLE means the response should be 416.
+func ParseRange(value string, size int64) ([]ByteRange, error) {
+	unit, rangeSet, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(unit) != "bytes" {
+		return nil, ERROR_INVALID_RANGE
+	}
+
+	specs := strings.Split(rangeSet, ",")
+	if len(specs) > maxRanges {
+		return nil, ERROR_INVALID_RANGE
+	}
+
+	ranges := []ByteRange{}
+	totalLength := int64(0)
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, ERROR_INVALID_RANGE
+		}
+
+		var byteRange ByteRange
+		if first == "" {
+			suffixLength, err := parseRangeNumber(last)
+			if err != nil {
+				return nil, err
+			}
+			if suffixLength == 0 || size == 0 {
+				continue
+			}
+			suffixLength = min(suffixLength, size)
+			byteRange = ByteRange{Start: size - suffixLength, Length: suffixLength}
+		} else {
+			start, err := parseRangeNumber(first)
+			if err != nil {
+				return nil, err
+			}
+
+			end := size - 1
+			if last != "" {
+				end, err = parseRangeNumber(last)
+				if err != nil {
+					return nil, err
+				}
+				if end < start {
+					return nil, ERROR_INVALID_RANGE
+				}
+				end = min(end, size-1)
+			}
+
+			if start >= size {
+				continue
+			}
+			byteRange = ByteRange{Start: start, Length: end - start + 1}
+		}
+
+		totalLength += byteRange.Length
+		ranges = append(ranges, byteRange)
+	}
+
+	if len(ranges) == 0 {
+		return nil, ERROR_RANGE_NOT_SATISFIABLE
+	}
+
+	// asking for more than the whole representation is either a mistake or an attack, send it once
+	if totalLength > size {
+		return nil, ERROR_INVALID_RANGE
+	}
+
+	return ranges, nil
+}
+
+func parseRangeNumber(value string) (int64, error) {
+	if value == "" || strings.TrimLeft(value, "0123456789") != "" {
+		return 0, ERROR_INVALID_RANGE
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, ERROR_INVALID_RANGE
+	}
+
+	return number, nil
+}
+
+// IfRangeMatches reports whether a Range header should be honoured given the If-Range value.
+// An If-Range ETag only matches strongly, an If-Range date only matches the exact Last-Modified.
+func IfRangeMatches(ifRange, etag string, lastModified time.Time) bool {
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, "\"") {
+		return etag != "" && !strings.HasPrefix(etag, "W/") && ifRange == etag
+	}
+
+	date, err := time.Parse(HTTP_DATE_FORMAT, ifRange)
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+
+	return lastModified.UTC().Truncate(time.Second).Equal(date)
+}
@@ -0,0 +1,55 @@
+package response
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	// Test: Single closed range
+	ranges, err := ParseRange("bytes=0-99", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 0, Length: 100}}, ranges)
+	assert.Equal(t, "bytes 0-99/1000", ranges[0].ContentRange(1000))
+
+	// Test: Open ended and suffix ranges
+	ranges, err = ParseRange("bytes=900-, -50", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 900, Length: 100}, {Start: 950, Length: 50}}, ranges)
+
+	// Test: Last byte past the end is clamped
+	ranges, err = ParseRange("bytes=990-2000", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 990, Length: 10}}, ranges)
+
+	// Test: Suffix longer than the representation
+	ranges, err = ParseRange("bytes=-5000", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 0, Length: 1000}}, ranges)
+
+	// Test: Unsatisfiable
+	_, err = ParseRange("bytes=1000-", 1000)
+	require.ErrorIs(t, err, ERROR_RANGE_NOT_SATISFIABLE)
+	_, err = ParseRange("bytes=-0", 1000)
+	require.ErrorIs(t, err, ERROR_RANGE_NOT_SATISFIABLE)
+
+	// Test: Invalid ranges are ignored
+	for _, value := range []string{"items=0-1", "bytes=5-1", "bytes=a-b", "bytes=1", "bytes=+1-2", "bytes=0-999,0-999"} {
+		_, err = ParseRange(value, 1000)
+		require.ErrorIs(t, err, ERROR_INVALID_RANGE, value)
+	}
+}
+
+func TestIfRangeMatches(t *testing.T) {
+	modified := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	assert.True(t, IfRangeMatches("", "", modified))
+	assert.True(t, IfRangeMatches("Tue, 04 Mar 2025 05:06:07 GMT", "", modified))
+	assert.False(t, IfRangeMatches("Tue, 04 Mar 2025 05:06:08 GMT", "", modified))
+	assert.True(t, IfRangeMatches("\"abc\"", "\"abc\"", modified))
+	assert.False(t, IfRangeMatches("\"abc\"", "\"abd\"", modified))
+	assert.False(t, IfRangeMatches("W/\"abc\"", "W/\"abc\"", modified))
+}
@@ -0,0 +1,261 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"httpfromtcp/internal/headers"
+)
+
+const (
+	// MAX_HEADER_SIZE limits the status line and the header or trailer section of a parsed response
+	MAX_HEADER_SIZE = 64 * 1024
+)
+
+var (
+	ERROR_MALFORMED_STATUS_LINE    = fmt.Errorf("error: malformed status line")
+	ERROR_MALFORMED_CHUNK          = fmt.Errorf("error: malformed chunk")
+	ERROR_INVALID_CONTENT_LENGTH   = fmt.Errorf("error: invalid content-length")
+	ERROR_RESPONSE_HEADER_TOO_LONG = fmt.Errorf("error: response header is too long")
+)
+
+// Response is a parsed response, its body is read from the underlying reader as it is consumed
+type Response struct {
+	HttpVersion string
+	StatusCode  StatusCode
+	Reason      string
+	Headers     headers.Headers
+	Body        io.Reader
+	// ContentLength is -1 unless the body is framed by Content-Length
+	ContentLength int64
+	// Trailers are filled in once a chunked body was read to the end
+	Trailers headers.Headers
+	// CloseDelimited bodies end when the connection is closed
+	CloseDelimited bool
+}
+
+// ResponseFromReader parses the status line and headers of the next response, interim 1xx
+// responses included, and frames its body without reading it. method is the method of the
+// request it answers, the body of a HEAD response is always empty. Pass a *bufio.Reader to
+// read several responses from the same connection, any other reader gets buffered.
+func ResponseFromReader(reader io.Reader, method string) (*Response, error) {
+	buffered, ok := reader.(*bufio.Reader)
+	if !ok {
+		buffered = bufio.NewReader(reader)
+	}
+
+	statusLine, err := readLine(buffered)
+	if err != nil {
+		return nil, err
+	}
+	version, status, _ := strings.Cut(statusLine, " ")
+	codeText, reason, _ := strings.Cut(status, " ")
+	statusCode, err := strconv.Atoi(codeText)
+	if !strings.HasPrefix(version, "HTTP/1.") || err != nil || len(codeText) != 3 || statusCode < 100 {
+		return nil, ERROR_MALFORMED_STATUS_LINE
+	}
+
+	responseHeaders, err := readFields(buffered)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Response{
+		HttpVersion:   strings.TrimPrefix(version, "HTTP/"),
+		StatusCode:    StatusCode(statusCode),
+		Reason:        reason,
+		Headers:       responseHeaders,
+		ContentLength: -1,
+		Trailers:      headers.Headers{},
+	}
+	if err := r.frameBody(buffered, method); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Informational reports whether r is an interim response that a final one follows
+func (r *Response) Informational() bool {
+	return r.StatusCode < 200 && r.StatusCode != SWITCHING_PROTOCOLS
+}
+
+// KeepAlive reports whether the connection can carry another exchange once the body was read
+func (r *Response) KeepAlive() bool {
+	if r.CloseDelimited || r.StatusCode == SWITCHING_PROTOCOLS {
+		return false
+	}
+	if r.HttpVersion == "1.0" {
+		return r.Headers.HasToken("connection", "keep-alive")
+	}
+
+	return !r.Headers.HasToken("connection", "close")
+}
+
+// frameBody picks how the end of the body is found, see RFC 9112 section 6.3
+func (r *Response) frameBody(reader *bufio.Reader, method string) error {
+	transferEncoding := r.Headers.Get("transfer-encoding")
+	switch {
+	case method == "HEAD" || r.StatusCode < 200 || r.StatusCode == NO_CONTENT || r.StatusCode == NOT_MODIFIED:
+		r.ContentLength = 0
+		r.Body = bytes.NewReader(nil)
+	case transferEncoding != "":
+		// a Transfer-Encoding overrides Content-Length, the body is close-delimited unless chunked is the last coding
+		codings := strings.Split(transferEncoding, ",")
+		if strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked") {
+			r.Body = &chunkedReader{reader: reader, trailers: r.Trailers}
+		} else {
+			r.CloseDelimited = true
+			r.Body = reader
+		}
+	case r.Headers.Get("content-length") != "":
+		length, err := strconv.ParseInt(r.Headers.Get("content-length"), 10, 64)
+		if err != nil || length < 0 {
+			return ERROR_INVALID_CONTENT_LENGTH
+		}
+		r.ContentLength = length
+		r.Body = &lengthReader{reader: reader, remaining: length}
+	default:
+		r.CloseDelimited = true
+		r.Body = reader
+	}
+
+	return nil
+}
+
+// lengthReader reads a body framed by Content-Length, failing when the connection ends early
+type lengthReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (l *lengthReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+
+	n, err := l.reader.Read(p)
+	l.remaining -= int64(n)
+	if err == io.EOF && l.remaining > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+	if l.remaining == 0 {
+		return n, io.EOF
+	}
+
+	return n, err
+}
+
+// chunkedReader removes the chunked framing of a body and collects the trailer fields
+type chunkedReader struct {
+	reader    *bufio.Reader
+	remaining int64
+	done      bool
+	trailers  headers.Headers
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, io.EOF
+	}
+
+	if c.remaining == 0 {
+		sizeLine, err := readLine(c.reader)
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		sizeText, _, _ := strings.Cut(sizeLine, ";")
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeText), 16, 64)
+		if err != nil || size < 0 {
+			return 0, ERROR_MALFORMED_CHUNK
+		}
+
+		if size == 0 {
+			trailers, err := readFields(c.reader)
+			if err != nil {
+				return 0, unexpectedEOF(err)
+			}
+			for name, value := range trailers {
+				c.trailers.Set(name, value)
+			}
+			c.done = true
+			return 0, io.EOF
+		}
+		c.remaining = size
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.reader.Read(p)
+	c.remaining -= int64(n)
+	if err != nil {
+		return n, unexpectedEOF(err)
+	}
+
+	if c.remaining == 0 {
+		if line, err := readLine(c.reader); err != nil || line != "" {
+			return n, ERROR_MALFORMED_CHUNK
+		}
+	}
+
+	return n, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// readLine reads a line without buffering more than MAX_HEADER_SIZE
+func readLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > MAX_HEADER_SIZE {
+			return "", ERROR_RESPONSE_HEADER_TOO_LONG
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+// readFields reads header or trailer fields up to the empty line ending them
+func readFields(reader *bufio.Reader) (headers.Headers, error) {
+	fields := headers.Headers{}
+	size := 0
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			return fields, nil
+		}
+
+		size += len(line)
+		if size > MAX_HEADER_SIZE {
+			return nil, ERROR_RESPONSE_HEADER_TOO_LONG
+		}
+		if _, _, err := fields.Parse([]byte(line + "\r\n")); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package response
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type chunkReader struct {
+	data            string
+	numBytesPerRead int
+	pos             int
+}
+
+// Read reads up to len(p) or numBytesPerRead bytes from the string per call
+// its useful for simulating reading a variable number of bytes per chunk from a network connection
+func (cr *chunkReader) Read(p []byte) (n int, err error) {
+	if cr.pos >= len(cr.data) {
+		return 0, io.EOF
+	}
+	endIndex := cr.pos + cr.numBytesPerRead
+	if endIndex > len(cr.data) {
+		endIndex = len(cr.data)
+	}
+	n = copy(p, cr.data[cr.pos:endIndex])
+	cr.pos += n
+
+	return n, nil
+}
+
+func TestResponseFromReader(t *testing.T) {
+	// Test: Content-Length body
+	reader := &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 13\r\n\r\nHello World!\n",
+		numBytesPerRead: 3,
+	}
+	r, err := ResponseFromReader(reader, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "1.1", r.HttpVersion)
+	assert.Equal(t, StatusCode(OK), r.StatusCode)
+	assert.Equal(t, "OK", r.Reason)
+	assert.Equal(t, "text/plain", r.Headers.Get("content-type"))
+	assert.Equal(t, int64(13), r.ContentLength)
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello World!\n", string(body))
+	assert.True(t, r.KeepAlive())
+
+	// Test: Chunked body with extensions and trailers
+	reader = &chunkReader{
+		data: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Checksum\r\n\r\n" +
+			"6\r\nHello \r\n6;ext=1\r\nWorld!\r\n0\r\nX-Checksum: abc\r\n\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = ResponseFromReader(reader, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), r.ContentLength)
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello World!", string(body))
+	assert.Equal(t, "abc", r.Trailers.Get("x-checksum"))
+
+	// Test: Transfer-Encoding overrides Content-Length
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nContent-Length: 100\r\n\r\n2\r\nok\r\n0\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err = ResponseFromReader(reader, "GET")
+	require.NoError(t, err)
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+
+	// Test: Close-delimited body
+	reader = &chunkReader{
+		data:            "HTTP/1.0 200 OK\r\nServer: old\r\n\r\nuntil the connection closes",
+		numBytesPerRead: 4,
+	}
+	r, err = ResponseFromReader(reader, "GET")
+	require.NoError(t, err)
+	assert.True(t, r.CloseDelimited)
+	assert.False(t, r.KeepAlive())
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "until the connection closes", string(body))
+
+	// Test: HEAD, 204 and 304 responses have no body
+	for method, raw := range map[string]string{
+		"HEAD": "HTTP/1.1 200 OK\r\nContent-Length: 42\r\n\r\n",
+		"GET":  "HTTP/1.1 204 No Content\r\n\r\n",
+		"PUT":  "HTTP/1.1 304 Not Modified\r\nTransfer-Encoding: chunked\r\n\r\n",
+	} {
+		r, err = ResponseFromReader(strings.NewReader(raw), method)
+		require.NoError(t, err)
+		body, err = io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Empty(t, body)
+		assert.True(t, r.KeepAlive())
+	}
+
+	// Test: Interim and final responses read from the same buffered reader
+	buffered := bufio.NewReader(&chunkReader{
+		data:            "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 103 Early Hints\r\nLink: </style.css>\r\n\r\nHTTP/1.1 201 Created\r\nContent-Length: 4\r\nConnection: close\r\n\r\ndone",
+		numBytesPerRead: 7,
+	})
+	r, err = ResponseFromReader(buffered, "POST")
+	require.NoError(t, err)
+	assert.True(t, r.Informational())
+	assert.Equal(t, StatusCode(CONTINUE), r.StatusCode)
+	r, err = ResponseFromReader(buffered, "POST")
+	require.NoError(t, err)
+	assert.True(t, r.Informational())
+	assert.Equal(t, "</style.css>", r.Headers.Get("link"))
+	r, err = ResponseFromReader(buffered, "POST")
+	require.NoError(t, err)
+	assert.False(t, r.Informational())
+	assert.Equal(t, StatusCode(CREATED), r.StatusCode)
+	assert.False(t, r.KeepAlive())
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "done", string(body))
+
+	// Test: Keep-alive HTTP/1.0 response
+	r, err = ResponseFromReader(strings.NewReader("HTTP/1.0 200 OK\r\nConnection: keep-alive\r\nContent-Length: 0\r\n\r\n"), "GET")
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+}
+
+func TestResponseFromReaderErrors(t *testing.T) {
+	// Test: Malformed status lines
+	for _, statusLine := range []string{"HTTP/2 200 OK", "HTTP/1.1 2000 OK", "HTTP/1.1 OK", "ICY 200 OK", "HTTP/1.1 099 Low"} {
+		_, err := ResponseFromReader(strings.NewReader(statusLine+"\r\n\r\n"), "GET")
+		assert.ErrorIs(t, err, ERROR_MALFORMED_STATUS_LINE, statusLine)
+	}
+
+	// Test: Invalid Content-Length
+	_, err := ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: -1\r\n\r\n"), "GET")
+	assert.ErrorIs(t, err, ERROR_INVALID_CONTENT_LENGTH)
+
+	// Test: Truncated head
+	_, err = ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n"), "GET")
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Header section too long
+	_, err = ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nX-Big: "+strings.Repeat("a", MAX_HEADER_SIZE)+"\r\n\r\n"), "GET")
+	assert.ErrorIs(t, err, ERROR_RESPONSE_HEADER_TOO_LONG)
+
+	// Test: Truncated Content-Length body
+	r, err := ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort"), "GET")
+	require.NoError(t, err)
+	body, err := io.ReadAll(r.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "short", string(body))
+
+	// Test: Malformed and truncated chunks
+	for _, chunks := range []string{"zz\r\nhello\r\n0\r\n\r\n", "2\r\nhello\r\n0\r\n\r\n"} {
+		r, err = ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n"+chunks), "GET")
+		require.NoError(t, err)
+		_, err = io.ReadAll(r.Body)
+		assert.ErrorIs(t, err, ERROR_MALFORMED_CHUNK, chunks)
+	}
+	r, err = ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhel"), "GET")
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
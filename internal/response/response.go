@@ -8,13 +8,70 @@ import (
 )
 
 const (
-	OK                    = 200
-	BAD_REQUEST           = 400
-	INTERNAL_SERVER_ERROR = 500
+	CONTINUE                        = 100
+	SWITCHING_PROTOCOLS             = 101
+	EARLY_HINTS                     = 103
+	OK                              = 200
+	CREATED                         = 201
+	NO_CONTENT                      = 204
+	PARTIAL_CONTENT                 = 206
+	MOVED_PERMANENTLY               = 301
+	FOUND                           = 302
+	SEE_OTHER                       = 303
+	NOT_MODIFIED                    = 304
+	TEMPORARY_REDIRECT              = 307
+	PERMANENT_REDIRECT              = 308
+	BAD_REQUEST                     = 400
+	FORBIDDEN                       = 403
+	NOT_FOUND                       = 404
+	METHOD_NOT_ALLOWED              = 405
+	PRECONDITION_FAILED             = 412
+	CONTENT_TOO_LARGE               = 413
+	UNSUPPORTED_MEDIA_TYPE          = 415
+	RANGE_NOT_SATISFIABLE           = 416
+	EXPECTATION_FAILED              = 417
+	UPGRADE_REQUIRED                = 426
+	TOO_MANY_REQUESTS               = 429
+	REQUEST_HEADER_FIELDS_TOO_LARGE = 431
+	INTERNAL_SERVER_ERROR           = 500
+	BAD_GATEWAY                     = 502
+	SERVICE_UNAVAILABLE             = 503
+	GATEWAY_TIMEOUT                 = 504
 )
 
 var (
 	chunkedBytesBuffer = bytes.NewBuffer([]byte{})
+	statusText         = map[StatusCode]string{
+		CONTINUE:                        "Continue",
+		SWITCHING_PROTOCOLS:             "Switching Protocols",
+		EARLY_HINTS:                     "Early Hints",
+		OK:                              "OK",
+		CREATED:                         "Created",
+		NO_CONTENT:                      "No Content",
+		PARTIAL_CONTENT:                 "Partial Content",
+		MOVED_PERMANENTLY:               "Moved Permanently",
+		FOUND:                           "Found",
+		SEE_OTHER:                       "See Other",
+		NOT_MODIFIED:                    "Not Modified",
+		TEMPORARY_REDIRECT:              "Temporary Redirect",
+		PERMANENT_REDIRECT:              "Permanent Redirect",
+		BAD_REQUEST:                     "Bad Request",
+		FORBIDDEN:                       "Forbidden",
+		NOT_FOUND:                       "Not Found",
+		METHOD_NOT_ALLOWED:              "Method Not Allowed",
+		PRECONDITION_FAILED:             "Precondition Failed",
+		CONTENT_TOO_LARGE:               "Content Too Large",
+		UNSUPPORTED_MEDIA_TYPE:          "Unsupported Media Type",
+		RANGE_NOT_SATISFIABLE:           "Range Not Satisfiable",
+		EXPECTATION_FAILED:              "Expectation Failed",
+		UPGRADE_REQUIRED:                "Upgrade Required",
+		TOO_MANY_REQUESTS:               "Too Many Requests",
+		REQUEST_HEADER_FIELDS_TOO_LARGE: "Request Header Fields Too Large",
+		INTERNAL_SERVER_ERROR:           "Internal Server Error",
+		BAD_GATEWAY:                     "Bad Gateway",
+		SERVICE_UNAVAILABLE:             "Service Unavailable",
+		GATEWAY_TIMEOUT:                 "Gateway Timeout",
+	}
 )
 
 type Writer struct {
@@ -26,23 +83,17 @@ type Writer struct {
 
 type StatusCode int
 
+// StatusText returns the reason phrase for statusCode, or an empty string if it is unknown
+func StatusText(statusCode StatusCode) string {
+	return statusText[statusCode]
+}
+
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
-	var statusLine []byte
-	switch statusCode {
-	case OK:
-		statusLine = []byte("HTTP/1.1 200 OK\r\n")
-		break
-	case BAD_REQUEST:
-		statusLine = []byte("HTTP/1.1 400 Bad Request\r\n")
-		break
-	case INTERNAL_SERVER_ERROR:
-		statusLine = []byte("HTTP/1.1 500 Internal Server Error\r\n")
-		break
-	default:
-		statusLine = []byte("\r\n")
+	if statusCode < 100 || statusCode > 999 {
+		return fmt.Errorf("error: invalid status code %d", statusCode)
 	}
 
-	w.StatusLine = statusLine
+	w.StatusLine = []byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, StatusText(statusCode)))
 
 	return nil
 }
@@ -50,9 +101,9 @@ func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 func GetDefaultHeaders(contentLength int) headers.Headers {
 	defaultHeaders := headers.Headers{}
 
-	defaultHeaders["Content-Length"] = fmt.Sprintf("%d", contentLength)
-	defaultHeaders["Connection"] = "close"
-	defaultHeaders["Content-Type"] = "text/html"
+	defaultHeaders["content-length"] = fmt.Sprintf("%d", contentLength)
+	defaultHeaders["connection"] = "close"
+	defaultHeaders["content-type"] = "text/html"
 
 	return defaultHeaders
 }
@@ -60,22 +111,12 @@ func GetDefaultHeaders(contentLength int) headers.Headers {
 func GetChunkedHeaders() headers.Headers {
 	chunkedHeaders := headers.Headers{}
 
-	chunkedHeaders["Content-Type"] = "text/plain"
-	chunkedHeaders["Transfer-Encoding"] = "chunked"
+	chunkedHeaders["content-type"] = "text/plain"
+	chunkedHeaders["transfer-encoding"] = "chunked"
 
 	return chunkedHeaders
 }
 
-func GetVideoHeaders(contentLength int) headers.Headers {
-	videoHeaders := headers.Headers{}
-
-	videoHeaders["content-type"] = "video/mp4"
-	videoHeaders["content-length"] = fmt.Sprintf("%d", contentLength)
-	videoHeaders["connection"] = "close"
-
-	return videoHeaders
-}
-
 func (w *Writer) WriteHeaders(headers headers.Headers) error {
 	headerByteBuffer := bytes.NewBuffer([]byte{})
 	for k, v := range headers {
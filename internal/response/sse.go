@@ -0,0 +1,78 @@
+package response
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EVENT_STREAM_CONTENT_TYPE = "text/event-stream"
+)
+
+var (
+	ERROR_INVALID_EVENT_FIELD = fmt.Errorf("error: event id and name can not contain line breaks")
+)
+
+// Event is a server-sent event, empty fields are left out, see the HTML event stream format
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	// Retry tells the client how long to wait before reconnecting, it is sent in milliseconds
+	Retry time.Duration
+}
+
+// Format renders the event, splitting Data on every line break into its own data field
+func (e Event) Format() ([]byte, error) {
+	if strings.ContainsAny(e.ID, "\r\n\x00") || strings.ContainsAny(e.Event, "\r\n") {
+		return nil, ERROR_INVALID_EVENT_FIELD
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	if e.ID != "" {
+		fmt.Fprintf(buffer, "id: %s\n", e.ID)
+	}
+	if e.Event != "" {
+		fmt.Fprintf(buffer, "event: %s\n", e.Event)
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(buffer, "retry: %s\n", strconv.FormatInt(e.Retry.Milliseconds(), 10))
+	}
+	if e.Data != "" || buffer.Len() == 0 {
+		data := strings.ReplaceAll(e.Data, "\r\n", "\n")
+		data = strings.ReplaceAll(data, "\r", "\n")
+		for _, line := range strings.Split(data, "\n") {
+			fmt.Fprintf(buffer, "data: %s\n", line)
+		}
+	}
+	buffer.WriteString("\n")
+
+	return buffer.Bytes(), nil
+}
+
+// WriteEvent writes the formatted event to w
+func WriteEvent(w io.Writer, e Event) error {
+	formatted, err := e.Format()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(formatted)
+	return err
+}
+
+// WriteComment writes a comment line clients ignore, useful to keep idle connections open
+func WriteComment(w io.Writer, comment string) error {
+	buffer := bytes.NewBuffer([]byte{})
+	for _, line := range strings.Split(strings.ReplaceAll(comment, "\r", ""), "\n") {
+		fmt.Fprintf(buffer, ": %s\n", line)
+	}
+	buffer.WriteString("\n")
+
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
@@ -0,0 +1,38 @@
+package response
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventFormat(t *testing.T) {
+	// Test: All fields
+	formatted, err := Event{ID: "42", Event: "update", Data: "hello", Retry: 3 * time.Second}.Format()
+	require.NoError(t, err)
+	assert.Equal(t, "id: 42\nevent: update\nretry: 3000\ndata: hello\n\n", string(formatted))
+
+	// Test: Every kind of line break starts a new data field
+	formatted, err = Event{Data: "one\ntwo\r\nthree\rfour"}.Format()
+	require.NoError(t, err)
+	assert.Equal(t, "data: one\ndata: two\ndata: three\ndata: four\n\n", string(formatted))
+
+	// Test: An empty event still dispatches
+	formatted, err = Event{}.Format()
+	require.NoError(t, err)
+	assert.Equal(t, "data: \n\n", string(formatted))
+
+	// Test: Line breaks in the id or name would start new fields
+	_, err = Event{ID: "1\nevent: forged"}.Format()
+	assert.ErrorIs(t, err, ERROR_INVALID_EVENT_FIELD)
+	_, err = Event{Event: "a\rb"}.Format()
+	assert.ErrorIs(t, err, ERROR_INVALID_EVENT_FIELD)
+
+	// Test: Comments
+	buffer := &bytes.Buffer{}
+	require.NoError(t, WriteComment(buffer, "keep-alive"))
+	assert.Equal(t, ": keep-alive\n\n", buffer.String())
+}
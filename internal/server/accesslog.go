@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LOG_FORMAT_COMMON   = "common"
+	LOG_FORMAT_COMBINED = "combined"
+	LOG_FORMAT_JSON     = "json"
+
+	ACCESS_LOG_REMOTE_ADDR  = "remote_addr"
+	ACCESS_LOG_METHOD       = "method"
+	ACCESS_LOG_TARGET       = "target"
+	ACCESS_LOG_PROTO        = "proto"
+	ACCESS_LOG_STATUS       = "status"
+	ACCESS_LOG_BYTES        = "bytes"
+	ACCESS_LOG_DURATION     = "duration"
+	ACCESS_LOG_USER_AGENT   = "user_agent"
+	ACCESS_LOG_REFERER      = "referer"
+	ACCESS_LOG_DEVIATIONS   = "deviations"
+	accessLogMessage        = "request"
+	commonLogFormatTimeForm = "02/Jan/2006:15:04:05 -0700"
+)
+
+var (
+	ERROR_UNKNOWN_LOG_FORMAT = fmt.Errorf("error: unknown access log format")
+)
+
+// NewAccessLogger returns a logger that writes one line per request to w in the given format.
+// Any other *slog.Logger can be used as an access logger as long as it accepts the ACCESS_LOG_* attributes.
+func NewAccessLogger(w io.Writer, format string) (*slog.Logger, error) {
+	switch format {
+	case LOG_FORMAT_COMMON, LOG_FORMAT_COMBINED:
+		return slog.New(&logFormatHandler{
+			writer: w,
+			format: format,
+			mu:     &sync.Mutex{},
+		}), nil
+	case LOG_FORMAT_JSON:
+		return slog.New(slog.NewJSONHandler(w, nil)), nil
+	default:
+		return nil, ERROR_UNKNOWN_LOG_FORMAT
+	}
+}
+
+// logFormatHandler renders access log records in Common or Combined Log Format
+type logFormatHandler struct {
+	writer io.Writer
+	format string
+	attrs  []slog.Attr
+	mu     *sync.Mutex
+}
+
+func (h *logFormatHandler) Enabled(_ context.Context, _ slog.Level) bool {
+	return true
+}
+
+func (h *logFormatHandler) Handle(_ context.Context, record slog.Record) error {
+	values := map[string]slog.Value{}
+	for _, attr := range h.attrs {
+		values[attr.Key] = attr.Value.Resolve()
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		values[attr.Key] = attr.Value.Resolve()
+		return true
+	})
+
+	logTime := record.Time
+	if logTime.IsZero() {
+		logTime = time.Now()
+	}
+
+	host := logField(values, ACCESS_LOG_REMOTE_ADDR)
+	if index := strings.LastIndex(host, ":"); index != -1 && !strings.HasSuffix(host, "]") {
+		host = host[:index]
+	}
+
+	requestLine := "-"
+	if method := logField(values, ACCESS_LOG_METHOD); method != "-" {
+		requestLine = fmt.Sprintf("%s %s %s", method, logField(values, ACCESS_LOG_TARGET), logField(values, ACCESS_LOG_PROTO))
+	}
+
+	bytesWritten := logField(values, ACCESS_LOG_BYTES)
+	if bytesWritten == "0" {
+		bytesWritten = "-"
+	}
+
+	line := fmt.Sprintf("%s - - [%s] \"%s\" %s %s",
+		host,
+		logTime.Format(commonLogFormatTimeForm),
+		requestLine,
+		logField(values, ACCESS_LOG_STATUS),
+		bytesWritten)
+
+	if h.format == LOG_FORMAT_COMBINED {
+		line += fmt.Sprintf(" \"%s\" \"%s\"", logField(values, ACCESS_LOG_REFERER), logField(values, ACCESS_LOG_USER_AGENT))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.writer, line+"\n")
+
+	return err
+}
+
+func (h *logFormatHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logFormatHandler{
+		writer: h.writer,
+		format: h.format,
+		attrs:  append(append([]slog.Attr{}, h.attrs...), attrs...),
+		mu:     h.mu,
+	}
+}
+
+func (h *logFormatHandler) WithGroup(_ string) slog.Handler {
+	return h
+}
+
+func logField(values map[string]slog.Value, key string) string {
+	value, ok := values[key]
+	if !ok {
+		return "-"
+	}
+
+	field := value.String()
+	if field == "" {
+		return "-"
+	}
+
+	return strings.ReplaceAll(field, "\"", "\\\"")
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func logTestRequest(logger *slog.Logger) {
+	record := slog.NewRecord(time.Date(2025, 10, 10, 13, 55, 36, 0, time.UTC), slog.LevelInfo, accessLogMessage, 0)
+	record.AddAttrs(
+		slog.String(ACCESS_LOG_REMOTE_ADDR, "127.0.0.1:51234"),
+		slog.String(ACCESS_LOG_METHOD, "GET"),
+		slog.String(ACCESS_LOG_TARGET, "/coffee"),
+		slog.String(ACCESS_LOG_PROTO, "HTTP/1.1"),
+		slog.Int(ACCESS_LOG_STATUS, 200),
+		slog.Int64(ACCESS_LOG_BYTES, 2326),
+		slog.String(ACCESS_LOG_USER_AGENT, "curl/7.81.0"),
+	)
+	_ = logger.Handler().Handle(context.Background(), record)
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	// Test: Common Log Format
+	buffer := &bytes.Buffer{}
+	logger, err := NewAccessLogger(buffer, LOG_FORMAT_COMMON)
+	require.NoError(t, err)
+	logTestRequest(logger)
+	assert.Equal(t, "127.0.0.1 - - [10/Oct/2025:13:55:36 +0000] \"GET /coffee HTTP/1.1\" 200 2326\n", buffer.String())
+
+	// Test: Combined Log Format
+	buffer = &bytes.Buffer{}
+	logger, err = NewAccessLogger(buffer, LOG_FORMAT_COMBINED)
+	require.NoError(t, err)
+	logTestRequest(logger)
+	assert.Equal(t, "127.0.0.1 - - [10/Oct/2025:13:55:36 +0000] \"GET /coffee HTTP/1.1\" 200 2326 \"-\" \"curl/7.81.0\"\n", buffer.String())
+
+	// Test: JSON
+	buffer = &bytes.Buffer{}
+	logger, err = NewAccessLogger(buffer, LOG_FORMAT_JSON)
+	require.NoError(t, err)
+	logTestRequest(logger)
+	assert.Contains(t, buffer.String(), "\"status\":200")
+	assert.Contains(t, buffer.String(), "\"user_agent\":\"curl/7.81.0\"")
+
+	// Test: Unknown format
+	_, err = NewAccessLogger(buffer, "apache")
+	require.ErrorIs(t, err, ERROR_UNKNOWN_LOG_FORMAT)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/response"
+)
+
+const (
+	DEFAULT_COMPRESSION_MIN_SIZE = 1024
+)
+
+var (
+	supportedEncodings = []string{response.ENCODING_GZIP, response.ENCODING_DEFLATE}
+)
+
+// WithCompression compresses responses of compressible content types that are at least
+// minSize bytes long, or of unknown length, when the client accepts gzip or deflate
+func WithCompression(minSize int) Option {
+	return func(s *Server) {
+		s.CompressionMinSize = minSize
+		s.Compression = true
+	}
+}
+
+// negotiateCompression returns the content coding to apply to a response, or an empty string
+// when it must be sent as is. A negative length means the length is not known yet.
+func (s *Server) negotiateCompression(acceptEncoding string, responseHeaders headers.Headers, length int64) string {
+	if !s.Compression {
+		return ""
+	}
+	if responseHeaders.Get("content-encoding") != "" || responseHeaders.Get("content-range") != "" {
+		return ""
+	}
+	if !response.IsCompressible(responseHeaders.Get("content-type")) {
+		return ""
+	}
+	if length >= 0 && length < int64(s.CompressionMinSize) {
+		return ""
+	}
+
+	encoding := response.NegotiateEncoding(acceptEncoding, supportedEncodings)
+	if encoding == response.ENCODING_IDENTITY {
+		return ""
+	}
+
+	return encoding
+}
+
+// markCompressed sets the headers of a response compressed with encoding. The ETag is weakened
+// because the compressed bytes differ from the ones it was computed on.
+func markCompressed(responseHeaders headers.Headers, encoding string) {
+	mergeHeaders(responseHeaders, headers.Headers{"content-encoding": encoding})
+	addVary(responseHeaders, "Accept-Encoding")
+
+	if etag := responseHeaders.Get("etag"); etag != "" {
+		mergeHeaders(responseHeaders, headers.Headers{"etag": response.WeakETag(etag)})
+	}
+}
+
+func addVary(responseHeaders headers.Headers, name string) {
+	vary := responseHeaders.Get("vary")
+	for _, existing := range strings.Split(vary, ",") {
+		if strings.EqualFold(strings.TrimSpace(existing), name) {
+			return
+		}
+	}
+	if vary != "" {
+		name = vary + ", " + name
+	}
+	mergeHeaders(responseHeaders, headers.Headers{"vary": name})
+}
+
+func newEncoder(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == response.ENCODING_DEFLATE {
+		return zlib.NewWriter(w)
+	}
+	return gzip.NewWriter(w)
+}
+
+func compressBody(encoding string, body []byte) ([]byte, error) {
+	buffer := bytes.NewBuffer([]byte{})
+	encoder := newEncoder(encoding, buffer)
+	if _, err := encoder.Write(body); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionStreamed(t *testing.T) {
+	srv := &Server{}
+	WithCompression(16)(srv)
+	text := strings.Repeat("compress me please ", 50)
+
+	serveCompressed := func(acceptEncoding, contentType string, contentLength bool) string {
+		buffer := &bytes.Buffer{}
+		w := newResponseWriter(buffer)
+		w.negotiateEncoding = func(responseHeaders headers.Headers, length int64) string {
+			return srv.negotiateCompression(acceptEncoding, responseHeaders, length)
+		}
+		w.Header().Set("content-type", contentType)
+		w.Header().Set("etag", "\"abc\"")
+		if contentLength {
+			w.Header().Set("content-length", fmt.Sprintf("%d", len(text)))
+		}
+		require.NoError(t, w.WriteHeader(response.OK))
+		w.Write([]byte(text[:100]))
+		w.Write([]byte(text[100:]))
+		require.NoError(t, w.finish())
+		return buffer.String()
+	}
+
+	// Test: Content-Length response is compressed and sent chunked
+	resp, err := response.ResponseFromReader(strings.NewReader(serveCompressed("gzip", "text/plain", true)), "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", resp.Headers.Get("content-encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Headers.Get("vary"))
+	assert.Equal(t, "chunked", resp.Headers.Get("transfer-encoding"))
+	assert.Equal(t, "W/\"abc\"", resp.Headers.Get("etag"))
+	assert.Equal(t, "", resp.Headers.Get("content-length"))
+	reader, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(decoded))
+
+	// Test: Deflate on a chunked response
+	resp, err = response.ResponseFromReader(strings.NewReader(serveCompressed("gzip;q=0.1, deflate", "application/json", false)), "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "deflate", resp.Headers.Get("content-encoding"))
+	zlibReader, err := zlib.NewReader(resp.Body)
+	require.NoError(t, err)
+	decoded, err = io.ReadAll(zlibReader)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(decoded))
+
+	// Test: Not accepted or not compressible
+	assert.NotContains(t, serveCompressed("", "text/plain", true), "content-encoding")
+	assert.NotContains(t, serveCompressed("gzip", "video/mp4", true), "content-encoding")
+}
+
+func TestCompressionBuffered(t *testing.T) {
+	listener := newPipeListener()
+	srv, err := ServeListener(listener, func(w io.Writer, req *request.Request) *HandlerError {
+		w.Write([]byte(strings.Repeat("all good ", 200)))
+		return nil
+	}, WithCompression(DEFAULT_COMPRESSION_MIN_SIZE))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn := listener.Dial()
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nAccept-Encoding: gzip\r\n\r\n"))
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+
+	responseHeaders, body, _ := strings.Cut(string(out), "\r\n\r\n")
+	assert.Contains(t, responseHeaders, "content-encoding:gzip")
+	assert.Contains(t, responseHeaders, fmt.Sprintf("content-length:%d", len(body)))
+	reader, err := gzip.NewReader(strings.NewReader(body))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Contains(t, string(decoded), "all good all good")
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+const (
+	DEFAULT_KEEP_ALIVE_INTERVAL = 15 * time.Second
+)
+
+var (
+	ERROR_EVENT_STREAM_CLOSED = fmt.Errorf("error: event stream is closed")
+)
+
+// EventStream sends server-sent events to a client until it disconnects, the handler calls Close
+// or the handler returns
+type EventStream struct {
+	// LastEventID is the id of the last event a reconnecting client received
+	LastEventID string
+
+	writer    *ResponseWriter
+	mutex     sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewEventStream starts a text/event-stream response and sends a keep-alive comment whenever
+// the stream was idle for keepAlive, 0 disables them. The server closes the stream once the
+// handler returned.
+func NewEventStream(w io.Writer, req *request.Request, keepAlive time.Duration) (*EventStream, *HandlerError) {
+	responseWriter, ok := w.(*ResponseWriter)
+	if !ok {
+		return nil, internalError()
+	}
+
+	header := responseWriter.Header()
+	header.Set("content-type", response.EVENT_STREAM_CONTENT_TYPE)
+	header.Set("cache-control", "no-cache")
+	// keeps proxies such as nginx from buffering the events
+	header.Set("x-accel-buffering", "no")
+	if err := responseWriter.WriteHeader(response.OK); err != nil {
+		return nil, internalError()
+	}
+
+	stream := &EventStream{
+		LastEventID: req.Headers.Get("last-event-id"),
+		writer:      responseWriter,
+		done:        make(chan struct{}),
+	}
+	responseWriter.eventStream = stream
+	go stream.watchDisconnect()
+	if keepAlive > 0 {
+		go stream.keepAlive(keepAlive)
+	}
+
+	return stream, nil
+}
+
+// Send writes event, failing once the client is gone
+func (s *EventStream) Send(event response.Event) error {
+	return s.write(func() error {
+		return response.WriteEvent(s.writer, event)
+	})
+}
+
+// Done is closed when the client disconnected or the stream was closed
+func (s *EventStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close stops the keep-alive comments, the server ends the response once the handler returns
+func (s *EventStream) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stop()
+}
+
+func (s *EventStream) stop() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+func (s *EventStream) write(write func() error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	select {
+	case <-s.done:
+		return ERROR_EVENT_STREAM_CLOSED
+	default:
+	}
+
+	if err := write(); err != nil {
+		s.stop()
+		return err
+	}
+
+	return nil
+}
+
+func (s *EventStream) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if s.write(func() error { return response.WriteComment(s.writer, "keep-alive") }) != nil {
+				return
+			}
+		}
+	}
+}
+
+// watchDisconnect reads from the connection, the client sends nothing else on an event stream
+// so the read only returns once it disconnected or the server closed the connection
+func (s *EventStream) watchDisconnect() {
+	if s.writer.netConn == nil {
+		return
+	}
+
+	buffer := make([]byte, 512)
+	for {
+		if _, err := s.writer.netConn.Read(buffer); err != nil {
+			s.stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readUntil reads from reader until the output contains want
+func readUntil(t *testing.T, reader *bufio.Reader, want string) string {
+	out := ""
+	for !strings.Contains(out, want) {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err, out)
+		out += line
+	}
+
+	return out
+}
+
+func TestEventStream(t *testing.T) {
+	disconnected := make(chan struct{})
+	handler := func(w io.Writer, req *request.Request) *HandlerError {
+		stream, herr := NewEventStream(w, req, 20*time.Millisecond)
+		if herr != nil {
+			return herr
+		}
+		defer stream.Close()
+
+		next, _ := strconv.Atoi(stream.LastEventID)
+		for i := next + 1; i <= next+2; i++ {
+			err := stream.Send(response.Event{ID: strconv.Itoa(i), Event: "tick", Data: fmt.Sprintf("line %d\nmore", i)})
+			require.NoError(t, err)
+		}
+
+		<-stream.Done()
+		assert.ErrorIs(t, stream.Send(response.Event{Data: "gone"}), ERROR_EVENT_STREAM_CLOSED)
+		close(disconnected)
+		return nil
+	}
+
+	listener := newPipeListener()
+	srv, err := ServeListener(listener, handler, WithCompression(0))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Test: Events continue after Last-Event-ID and keep-alive comments follow while idle
+	conn := listener.Dial()
+	_, err = conn.Write([]byte("GET /events HTTP/1.1\r\nHost: localhost\r\nAccept-Encoding: gzip\r\nLast-Event-ID: 7\r\n\r\n"))
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+
+	head := readUntil(t, reader, "\r\n\r\n")
+	assert.Contains(t, head, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, head, "content-type:text/event-stream\r\n")
+	assert.Contains(t, head, "cache-control:no-cache\r\n")
+	assert.NotContains(t, head, "content-encoding")
+
+	events := readUntil(t, reader, "id: 9\n")
+	events += readUntil(t, reader, ": keep-alive\n")
+	assert.Contains(t, events, "id: 8\nevent: tick\ndata: line 8\ndata: more\n\n")
+	assert.Contains(t, events, "id: 9\nevent: tick\ndata: line 9\ndata: more\n\n")
+
+	// Test: The handler notices the disconnect
+	conn.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not notice the disconnect")
+	}
+
+	// Test: The server stops the keep-alive comments when the handler returns without Close
+	streams := make(chan *EventStream, 1)
+	unclosed := func(w io.Writer, req *request.Request) *HandlerError {
+		stream, herr := NewEventStream(w, req, time.Millisecond)
+		if herr != nil {
+			return herr
+		}
+		streams <- stream
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+	listener = newPipeListener()
+	srv, err = ServeListener(listener, unclosed, WithCompression(0))
+	require.NoError(t, err)
+	defer srv.Close()
+	conn = listener.Dial()
+	_, err = conn.Write([]byte("GET /events HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), ": keep-alive\n")
+	assert.True(t, strings.HasSuffix(string(out), "\r\n0\r\n\r\n"), string(out))
+	select {
+	case <-(<-streams).Done():
+	default:
+		t.Fatal("stream was not closed")
+	}
+}
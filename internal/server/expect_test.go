@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"testing"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectContinue(t *testing.T) {
+	router := NewRouter()
+	router.Handle("/upload", func(w io.Writer, req *request.Request) *HandlerError {
+		if req.Headers.Get("content-length") != "5" {
+			return &HandlerError{StatusCode: response.CONTENT_TOO_LARGE, Message: []byte("too large")}
+		}
+		if herr := BodyError(req.ReadBody()); herr != nil {
+			return herr
+		}
+		w.Write(req.Body)
+		return nil
+	}, "POST")
+	router.Handle("/raw", func(w io.Writer, req *request.Request) *HandlerError {
+		fmt.Fprintf(w, "body=%q", req.Body)
+		return nil
+	}, "POST")
+	router.Handle("/hints", func(w io.Writer, req *request.Request) *HandlerError {
+		responseWriter := w.(*ResponseWriter)
+		err := responseWriter.WriteInformational(response.EARLY_HINTS, headers.Headers{"link": "</style.css>; rel=preload; as=style"})
+		require.NoError(t, err)
+		assert.ErrorIs(t, responseWriter.WriteInformational(response.OK, nil), ERROR_NOT_INFORMATIONAL)
+		w.Write([]byte("hinted"))
+		return nil
+	}, "GET")
+
+	listener := newPipeListener()
+	srv, err := ServeListener(listener, router.Serve)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Test: 100 Continue is sent once the handler reads the body
+	conn := listener.Dial()
+	_, err = conn.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n"))
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", line)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", line)
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	out, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, string(out), "hello")
+	conn.Close()
+
+	// Test: Rejecting without reading the body skips 100 Continue
+	out2 := sendRawRequest(t, listener, "POST /upload HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 9999\r\n\r\n")
+	assert.Contains(t, out2, "HTTP/1.1 413 Content Too Large\r\n")
+	assert.NotContains(t, out2, "100 Continue")
+
+	// Test: The body of a request with Expect is not read for handlers that only look at req.Body
+	out2 = sendRawRequest(t, listener, "POST /raw HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n")
+	assert.Contains(t, out2, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out2, `body=""`)
+	assert.NotContains(t, out2, "100 Continue")
+	out2 = sendRawRequest(t, listener, "POST /raw HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello")
+	assert.Contains(t, out2, `body="hello"`)
+
+	// Test: Unknown expectations are refused
+	out2 = sendRawRequest(t, listener, "POST /upload HTTP/1.1\r\nHost: localhost\r\nExpect: coffee\r\nContent-Length: 5\r\n\r\n")
+	assert.Contains(t, out2, "HTTP/1.1 417 Expectation Failed\r\n")
+
+	// Test: 103 Early Hints precede the final response
+	out2 = sendRawRequest(t, listener, "GET /hints HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out2, "HTTP/1.1 103 Early Hints\r\nlink:</style.css>; rel=preload; as=style\r\n\r\nHTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out2, "hinted")
+}
@@ -0,0 +1,340 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strings"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+const (
+	INDEX_FILE = "index.html"
+	sniffLen   = 512
+)
+
+// FileServer serves the files of Root for every request whose path starts with Prefix
+type FileServer struct {
+	Root   fs.FS
+	Prefix string
+	// ListDirectories renders an HTML listing for directories without an index.html
+	ListDirectories bool
+}
+
+func NewFileServer(root fs.FS, prefix string) *FileServer {
+	return &FileServer{
+		Root:   root,
+		Prefix: prefix,
+	}
+}
+
+func (f *FileServer) Handle(w io.Writer, req *request.Request) *HandlerError {
+	if req.RequestLine.Method != "GET" && req.RequestLine.Method != "HEAD" {
+		return &HandlerError{
+			StatusCode: response.METHOD_NOT_ALLOWED,
+			Message:    []byte("Only GET and HEAD are allowed"),
+			Headers:    headers.Headers{"allow": "GET, HEAD"},
+		}
+	}
+
+	urlPath, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	urlPath, err := url.PathUnescape(urlPath)
+	if err != nil || !strings.HasPrefix(urlPath, f.Prefix) {
+		return notFoundError()
+	}
+
+	name, ok := fsName(strings.TrimPrefix(urlPath, f.Prefix))
+	if !ok {
+		return notFoundError()
+	}
+
+	info, err := fs.Stat(f.Root, name)
+	if err != nil {
+		return fsError(err)
+	}
+	if !info.IsDir() {
+		return f.serveContent(w, req, name, info)
+	}
+
+	if !strings.HasSuffix(urlPath, "/") {
+		return &HandlerError{
+			StatusCode: response.MOVED_PERMANENTLY,
+			Message:    []byte("Moved to the directory"),
+			Headers:    headers.Headers{"location": (&url.URL{Path: urlPath + "/"}).EscapedPath()},
+		}
+	}
+
+	indexName := path.Join(name, INDEX_FILE)
+	if indexInfo, err := fs.Stat(f.Root, indexName); err == nil && !indexInfo.IsDir() {
+		return f.serveContent(w, req, indexName, indexInfo)
+	}
+
+	if !f.ListDirectories {
+		return &HandlerError{
+			StatusCode: response.FORBIDDEN,
+			Message:    []byte("Directory listing is disabled"),
+		}
+	}
+
+	return f.serveDirectory(w, urlPath, name)
+}
+
+// ServeFile writes the file name of Root no matter which path was requested
+func (f *FileServer) ServeFile(w io.Writer, req *request.Request, name string) *HandlerError {
+	info, err := fs.Stat(f.Root, name)
+	if err != nil {
+		return fsError(err)
+	}
+	if info.IsDir() {
+		return notFoundError()
+	}
+
+	return f.serveContent(w, req, name, info)
+}
+
+func (f *FileServer) serveContent(w io.Writer, req *request.Request, name string, info fs.FileInfo) *HandlerError {
+	responseWriter, ok := w.(*ResponseWriter)
+	if !ok {
+		return internalError()
+	}
+
+	file, err := f.Root.Open(name)
+	if err != nil {
+		return fsError(err)
+	}
+	defer file.Close()
+
+	seeker, seekable := file.(io.ReadSeeker)
+
+	var body io.Reader = file
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		sniffed := make([]byte, sniffLen)
+		n, err := io.ReadFull(file, sniffed)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fsError(err)
+		}
+		contentType = http.DetectContentType(sniffed[:n])
+
+		if seekable {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return fsError(err)
+			}
+		} else {
+			body = io.MultiReader(bytes.NewReader(sniffed[:n]), file)
+		}
+	}
+
+	size := info.Size()
+	responseWriter.Header().Set("content-type", contentType)
+	if !info.ModTime().IsZero() {
+		responseWriter.Header().Set("last-modified", info.ModTime().UTC().Format(response.HTTP_DATE_FORMAT))
+	}
+
+	responseWriter.Header().Set("etag", response.FileETag(size, info.ModTime()))
+
+	switch response.EvaluatePreconditions(req.Headers, req.RequestLine.Method, responseWriter.Header().Get("etag"), info.ModTime()) {
+	case response.NOT_MODIFIED:
+		if err := responseWriter.WriteHeader(response.NOT_MODIFIED); err != nil {
+			return internalError()
+		}
+		return nil
+	case response.PRECONDITION_FAILED:
+		return preconditionFailedError()
+	}
+
+	rangeHeader := req.Headers.Get("range")
+	if seekable {
+		responseWriter.Header().Set("accept-ranges", "bytes")
+
+		if rangeHeader != "" && response.IfRangeMatches(req.Headers.Get("if-range"), responseWriter.Header().Get("etag"), info.ModTime()) {
+			ranges, err := response.ParseRange(rangeHeader, size)
+			switch {
+			case errors.Is(err, response.ERROR_RANGE_NOT_SATISFIABLE):
+				return &HandlerError{
+					StatusCode: response.RANGE_NOT_SATISFIABLE,
+					Message:    []byte("Requested range not satisfiable"),
+					Headers:    headers.Headers{"content-range": fmt.Sprintf("bytes */%d", size)},
+				}
+			case err == nil && len(ranges) == 1:
+				return serveRange(responseWriter, seeker, ranges[0], size)
+			case err == nil:
+				return serveMultipartRanges(responseWriter, seeker, ranges, size, contentType)
+			}
+		}
+	}
+
+	responseWriter.Header().Set("content-length", fmt.Sprintf("%d", size))
+	if err := responseWriter.WriteHeader(response.OK); err != nil {
+		return internalError()
+	}
+	if responseWriter.suppressBody {
+		return nil
+	}
+
+	io.Copy(responseWriter, body)
+
+	return nil
+}
+
+func serveRange(w *ResponseWriter, content io.ReadSeeker, byteRange response.ByteRange, size int64) *HandlerError {
+	if _, err := content.Seek(byteRange.Start, io.SeekStart); err != nil {
+		return fsError(err)
+	}
+
+	w.Header().Set("content-range", byteRange.ContentRange(size))
+	w.Header().Set("content-length", fmt.Sprintf("%d", byteRange.Length))
+	if err := w.WriteHeader(response.PARTIAL_CONTENT); err != nil {
+		return internalError()
+	}
+
+	io.CopyN(w, content, byteRange.Length)
+
+	return nil
+}
+
+// serveMultipartRanges sends every range as its own part of a multipart/byteranges body
+func serveMultipartRanges(w *ResponseWriter, content io.ReadSeeker, ranges []response.ByteRange, size int64, contentType string) *HandlerError {
+	parts := multipart.NewWriter(w)
+
+	w.Header().Set("content-type", "multipart/byteranges; boundary="+parts.Boundary())
+	w.Header().Set("content-length", fmt.Sprintf("%d", multipartRangesLength(parts.Boundary(), ranges, size, contentType)))
+	if err := w.WriteHeader(response.PARTIAL_CONTENT); err != nil {
+		return internalError()
+	}
+
+	for _, byteRange := range ranges {
+		part, err := parts.CreatePart(byteRangeHeader(byteRange, size, contentType))
+		if err != nil {
+			return internalError()
+		}
+		if _, err := content.Seek(byteRange.Start, io.SeekStart); err != nil {
+			return internalError()
+		}
+		if _, err := io.CopyN(part, content, byteRange.Length); err != nil {
+			return internalError()
+		}
+	}
+	parts.Close()
+
+	return nil
+}
+
+// multipartRangesLength computes the size of the multipart/byteranges body up front
+// by writing everything but the ranges themselves
+func multipartRangesLength(boundary string, ranges []response.ByteRange, size int64, contentType string) int64 {
+	counter := &countingWriter{writer: io.Discard}
+	parts := multipart.NewWriter(counter)
+	parts.SetBoundary(boundary)
+
+	length := int64(0)
+	for _, byteRange := range ranges {
+		parts.CreatePart(byteRangeHeader(byteRange, size, contentType))
+		length += byteRange.Length
+	}
+	parts.Close()
+
+	return length + counter.bytesWritten
+}
+
+func byteRangeHeader(byteRange response.ByteRange, size int64, contentType string) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Type":  {contentType},
+		"Content-Range": {byteRange.ContentRange(size)},
+	}
+}
+
+func (f *FileServer) serveDirectory(w io.Writer, urlPath, name string) *HandlerError {
+	responseWriter, ok := w.(*ResponseWriter)
+	if !ok {
+		return internalError()
+	}
+
+	entries, err := fs.ReadDir(f.Root, name)
+	if err != nil {
+		return fsError(err)
+	}
+
+	listing := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(listing, "<html>\n  <head>\n    <title>Index of %s</title>\n  </head>\n  <body>\n    <h1>Index of %s</h1>\n    <ul>\n",
+		html.EscapeString(urlPath), html.EscapeString(urlPath))
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		link := (&url.URL{Path: entryName}).EscapedPath()
+		fmt.Fprintf(listing, "      <li><a href=\"%s\">%s</a></li>\n", html.EscapeString(link), html.EscapeString(entryName))
+	}
+	listing.WriteString("    </ul>\n  </body>\n</html>\n")
+
+	responseWriter.Header().Set("content-type", "text/html; charset=utf-8")
+	responseWriter.Header().Set("content-length", fmt.Sprintf("%d", listing.Len()))
+	if err := responseWriter.WriteHeader(response.OK); err != nil {
+		return internalError()
+	}
+	responseWriter.Write(listing.Bytes())
+
+	return nil
+}
+
+// fsName maps a URL path to a name inside an fs.FS, rejecting anything that could leave the root
+func fsName(urlPath string) (string, bool) {
+	if strings.ContainsAny(urlPath, "\\\x00") {
+		return "", false
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		name = "."
+	}
+
+	return name, fs.ValidPath(name)
+}
+
+func fsError(err error) *HandlerError {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return notFoundError()
+	case errors.Is(err, fs.ErrPermission):
+		return &HandlerError{
+			StatusCode: response.FORBIDDEN,
+			Message:    []byte("Permission denied"),
+		}
+	default:
+		return internalError()
+	}
+}
+
+func preconditionFailedError() *HandlerError {
+	return &HandlerError{
+		StatusCode: response.PRECONDITION_FAILED,
+		Message:    []byte("Precondition failed"),
+	}
+}
+
+func notFoundError() *HandlerError {
+	return &HandlerError{
+		StatusCode: response.NOT_FOUND,
+		Message:    []byte("File not found"),
+	}
+}
+
+func internalError() *HandlerError {
+	return &HandlerError{
+		StatusCode: response.INTERNAL_SERVER_ERROR,
+		Message:    []byte("Woopsie, my bad"),
+	}
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveFileRequest(fileServer *FileServer, method, target string) (string, *HandlerError) {
+	buffer := &bytes.Buffer{}
+	w := newResponseWriter(buffer)
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: method, RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     headers.Headers{},
+	}
+	herr := fileServer.Handle(w, req)
+	w.finish()
+
+	return buffer.String(), herr
+}
+
+func TestFileServer(t *testing.T) {
+	root := fstest.MapFS{
+		"index.html":        {Data: []byte("<h1>home</h1>")},
+		"css/site.css":      {Data: []byte("body {}")},
+		"docs/readme":       {Data: []byte("plain text readme")},
+		"docs/a b.txt":      {Data: []byte("spaces")},
+		"images/logo":       {Data: []byte("\x89PNG\r\n\x1a\n0000")},
+		"empty/placeholder": {Data: []byte("")},
+	}
+	fileServer := NewFileServer(root, "/static/")
+
+	// Test: Content-Type from extension and streamed body
+	out, herr := serveFileRequest(fileServer, "GET", "/static/css/site.css")
+	require.Nil(t, herr)
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, "content-type:text/css; charset=utf-8\r\n")
+	assert.Contains(t, out, "content-length:7\r\n")
+	assert.Contains(t, out, "\r\n\r\nbody {}")
+
+	// Test: Content-Type from sniffing
+	out, herr = serveFileRequest(fileServer, "GET", "/static/images/logo")
+	require.Nil(t, herr)
+	assert.Contains(t, out, "content-type:image/png\r\n")
+	out, herr = serveFileRequest(fileServer, "GET", "/static/docs/readme")
+	require.Nil(t, herr)
+	assert.Contains(t, out, "content-type:text/plain; charset=utf-8\r\n")
+	assert.Contains(t, out, "plain text readme")
+
+	// Test: index.html
+	out, herr = serveFileRequest(fileServer, "GET", "/static/")
+	require.Nil(t, herr)
+	assert.Contains(t, out, "<h1>home</h1>")
+
+	// Test: Directory without trailing slash redirects
+	_, herr = serveFileRequest(fileServer, "GET", "/static/docs")
+	require.NotNil(t, herr)
+	assert.Equal(t, 301, int(herr.StatusCode))
+	assert.Equal(t, "/static/docs/", herr.Headers["location"])
+
+	// Test: Directory listing is disabled by default
+	_, herr = serveFileRequest(fileServer, "GET", "/static/docs/")
+	require.NotNil(t, herr)
+	assert.Equal(t, 403, int(herr.StatusCode))
+
+	// Test: Directory listing
+	fileServer.ListDirectories = true
+	out, herr = serveFileRequest(fileServer, "GET", "/static/docs/")
+	require.Nil(t, herr)
+	assert.Contains(t, out, "<a href=\"a%20b.txt\">a b.txt</a>")
+	assert.Contains(t, out, "<a href=\"readme\">readme</a>")
+
+	// Test: Escaped path
+	out, herr = serveFileRequest(fileServer, "GET", "/static/docs/a%20b.txt")
+	require.Nil(t, herr)
+	assert.Contains(t, out, "spaces")
+
+	// Test: Traversal stays inside the root
+	for _, target := range []string{"/static/../static/css/../../etc", "/static/%2e%2e/%2e%2e/etc/passwd", "/static/..\\..\\etc", "/static/docs/%00"} {
+		_, herr = serveFileRequest(fileServer, "GET", target)
+		require.NotNil(t, herr, target)
+		assert.Equal(t, 404, int(herr.StatusCode), target)
+	}
+
+	// Test: Missing file and other prefixes
+	_, herr = serveFileRequest(fileServer, "GET", "/static/missing.txt")
+	require.NotNil(t, herr)
+	assert.Equal(t, 404, int(herr.StatusCode))
+	_, herr = serveFileRequest(fileServer, "GET", "/other/index.html")
+	require.NotNil(t, herr)
+	assert.Equal(t, 404, int(herr.StatusCode))
+
+	// Test: Only GET and HEAD
+	_, herr = serveFileRequest(fileServer, "POST", "/static/index.html")
+	require.NotNil(t, herr)
+	assert.Equal(t, 405, int(herr.StatusCode))
+	assert.Equal(t, "GET, HEAD", herr.Headers["allow"])
+}
+
+func TestFileServerRanges(t *testing.T) {
+	modified := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	root := fstest.MapFS{
+		"video.mp4": {Data: []byte("0123456789abcdefghij"), ModTime: modified},
+	}
+	fileServer := NewFileServer(root, "/")
+
+	serveRangeRequest := func(requestHeaders headers.Headers) (string, *HandlerError) {
+		buffer := &bytes.Buffer{}
+		w := newResponseWriter(buffer)
+		req := &request.Request{
+			RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/video.mp4", HttpVersion: "1.1"},
+			Headers:     requestHeaders,
+		}
+		herr := fileServer.Handle(w, req)
+		w.finish()
+		return buffer.String(), herr
+	}
+
+	// Test: Accept-Ranges is advertised
+	out, herr := serveRangeRequest(headers.Headers{})
+	require.Nil(t, herr)
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, "accept-ranges:bytes\r\n")
+	assert.Contains(t, out, "last-modified:Tue, 04 Mar 2025 05:06:07 GMT\r\n")
+
+	// Test: Single range
+	out, herr = serveRangeRequest(headers.Headers{"range": "bytes=2-5"})
+	require.Nil(t, herr)
+	assert.Contains(t, out, "HTTP/1.1 206 Partial Content\r\n")
+	assert.Contains(t, out, "content-range:bytes 2-5/20\r\n")
+	assert.Contains(t, out, "content-length:4\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n2345"))
+
+	// Test: Multiple ranges
+	out, herr = serveRangeRequest(headers.Headers{"range": "bytes=0-1,-2"})
+	require.Nil(t, herr)
+	assert.Contains(t, out, "HTTP/1.1 206 Partial Content\r\n")
+	responseHeaders, body, _ := strings.Cut(out, "\r\n\r\n")
+	_, boundary, _ := strings.Cut(responseHeaders, "content-type:multipart/byteranges; boundary=")
+	boundary, _, _ = strings.Cut(boundary, "\r\n")
+	assert.Contains(t, responseHeaders+"\r\n", fmt.Sprintf("content-length:%d\r\n", len(body)))
+	parts := multipart.NewReader(strings.NewReader(body), boundary)
+	for _, expected := range []struct{ contentRange, data string }{{"bytes 0-1/20", "01"}, {"bytes 18-19/20", "ij"}} {
+		part, err := parts.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, expected.contentRange, part.Header.Get("Content-Range"))
+		assert.Equal(t, "video/mp4", part.Header.Get("Content-Type"))
+		data, err := io.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, expected.data, string(data))
+	}
+	_, err := parts.NextPart()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Unsatisfiable range
+	_, herr = serveRangeRequest(headers.Headers{"range": "bytes=50-"})
+	require.NotNil(t, herr)
+	assert.Equal(t, 416, int(herr.StatusCode))
+	assert.Equal(t, "bytes */20", herr.Headers["content-range"])
+
+	// Test: If-Range with the current date honours the range
+	out, herr = serveRangeRequest(headers.Headers{"range": "bytes=0-0", "if-range": "Tue, 04 Mar 2025 05:06:07 GMT"})
+	require.Nil(t, herr)
+	assert.Contains(t, out, "HTTP/1.1 206 Partial Content\r\n")
+
+	// Test: If-Range with an old date sends everything
+	out, herr = serveRangeRequest(headers.Headers{"range": "bytes=0-0", "if-range": "Mon, 03 Mar 2025 05:06:07 GMT"})
+	require.Nil(t, herr)
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.True(t, strings.HasSuffix(out, "0123456789abcdefghij"))
+}
+
+func TestFileServerConditional(t *testing.T) {
+	modified := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	root := fstest.MapFS{
+		"page.html": {Data: []byte("<p>cached</p>"), ModTime: modified},
+	}
+	fileServer := NewFileServer(root, "/")
+
+	serveConditional := func(method string, requestHeaders headers.Headers) (string, *HandlerError) {
+		buffer := &bytes.Buffer{}
+		w := newResponseWriter(buffer)
+		req := &request.Request{
+			RequestLine: request.RequestLine{Method: method, RequestTarget: "/page.html", HttpVersion: "1.1"},
+			Headers:     requestHeaders,
+		}
+		herr := fileServer.Handle(w, req)
+		w.finish()
+		return buffer.String(), herr
+	}
+
+	out, herr := serveConditional("GET", headers.Headers{})
+	require.Nil(t, herr)
+	etag := response.FileETag(13, modified)
+	assert.Contains(t, out, "etag:"+etag+"\r\n")
+
+	// Test: Matching If-None-Match is not modified and has no body
+	out, herr = serveConditional("GET", headers.Headers{"if-none-match": etag})
+	require.Nil(t, herr)
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 304 Not Modified\r\n"))
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"))
+	assert.NotContains(t, out, "cached")
+	assert.NotContains(t, out, "transfer-encoding")
+
+	// Test: If-Modified-Since
+	out, herr = serveConditional("GET", headers.Headers{"if-modified-since": "Tue, 04 Mar 2025 05:06:07 GMT"})
+	require.Nil(t, herr)
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 304 Not Modified\r\n"))
+
+	// Test: Failed If-Match
+	_, herr = serveConditional("GET", headers.Headers{"if-match": "\"other\""})
+	require.NotNil(t, herr)
+	assert.Equal(t, response.StatusCode(response.PRECONDITION_FAILED), herr.StatusCode)
+
+	// Test: If-Range with the ETag
+	out, herr = serveConditional("GET", headers.Headers{"range": "bytes=0-2", "if-range": etag})
+	require.Nil(t, herr)
+	assert.Contains(t, out, "HTTP/1.1 206 Partial Content\r\n")
+}
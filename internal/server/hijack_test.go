@@ -0,0 +1,54 @@
+package server
+
+import (
+	"io"
+	"testing"
+
+	"httpfromtcp/internal/request"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHijack(t *testing.T) {
+	handler := func(w io.Writer, req *request.Request) *HandlerError {
+		hijacker, ok := w.(Hijacker)
+		require.True(t, ok)
+		conn, buffered, err := hijacker.Hijack()
+		require.NoError(t, err)
+		_, _, err = hijacker.Hijack()
+		assert.ErrorIs(t, err, ERROR_ALREADY_HIJACKED)
+
+		// the bytes sent right after the request are split between the buffer and the connection
+		rest := make([]byte, len("PING")-len(buffered))
+		_, err = io.ReadFull(conn, rest)
+		require.NoError(t, err)
+
+		returned := make(chan struct{})
+		defer close(returned)
+		go func() {
+			<-returned
+			conn.Write(append(append(buffered, rest...), " after return"...))
+			conn.Close()
+		}()
+
+		return nil
+	}
+
+	listener := newPipeListener()
+	srv, err := ServeListener(listener, handler)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Test: The handler owns the connection, the server writes nothing and does not close it
+	out := sendRawRequest(t, listener, "GET /tunnel HTTP/1.1\r\nHost: localhost\r\n\r\nPING")
+	assert.Equal(t, "PING after return", out)
+
+	// Test: Bytes past Content-Length are handed over too
+	out = sendRawRequest(t, listener, "POST /tunnel HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\nabcPING")
+	assert.Equal(t, "PING after return", out)
+
+	// Test: Not hijackable outside of the server
+	_, _, err = newResponseWriter(io.Discard).Hijack()
+	assert.ErrorIs(t, err, ERROR_NOT_HIJACKABLE)
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"httpfromtcp/internal/response"
+)
+
+type ConnectionLimitMode int
+
+const (
+	// CONNECTION_LIMIT_BLOCK stops accepting connections while the server is full,
+	// leaving new clients waiting in the listen backlog
+	CONNECTION_LIMIT_BLOCK ConnectionLimitMode = iota
+	// CONNECTION_LIMIT_REJECT accepts connections while the server is full and answers them with 503
+	CONNECTION_LIMIT_REJECT
+
+	rejectWriteTimeout = 5 * time.Second
+	rejectDrainTimeout = 500 * time.Millisecond
+	rejectDrainLimit   = 64 * 1024
+)
+
+// connectionLimiter caps the number of concurrent connections in total and per remote IP
+type connectionLimiter struct {
+	slots    chan struct{}
+	mode     ConnectionLimitMode
+	done     chan struct{}
+	maxPerIP int
+
+	mu          sync.Mutex
+	activePerIP map[string]int
+}
+
+// WithMaxConnections limits the number of connections handled at the same time
+func WithMaxConnections(max int, mode ConnectionLimitMode) Option {
+	return func(s *Server) {
+		limiter := s.getConnectionLimiter()
+		limiter.slots = make(chan struct{}, max)
+		limiter.mode = mode
+	}
+}
+
+// WithMaxConnectionsPerIP limits the number of connections handled at the same time for a single remote IP.
+// Connections over the limit are answered with 503.
+func WithMaxConnectionsPerIP(max int) Option {
+	return func(s *Server) {
+		s.getConnectionLimiter().maxPerIP = max
+	}
+}
+
+func (s *Server) getConnectionLimiter() *connectionLimiter {
+	if s.connectionLimiter == nil {
+		s.connectionLimiter = &connectionLimiter{
+			done:        make(chan struct{}),
+			activePerIP: map[string]int{},
+		}
+		s.onClose = append(s.onClose, func() {
+			close(s.connectionLimiter.done)
+		})
+	}
+
+	return s.connectionLimiter
+}
+
+// wait blocks until a connection slot is free in CONNECTION_LIMIT_BLOCK mode.
+// It returns false when the server is closed while waiting.
+func (c *connectionLimiter) wait() bool {
+	if c == nil || c.slots == nil || c.mode != CONNECTION_LIMIT_BLOCK {
+		return true
+	}
+
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// cancelWait gives back the slot reserved by wait when no connection was accepted
+func (c *connectionLimiter) cancelWait() {
+	if c == nil || c.slots == nil || c.mode != CONNECTION_LIMIT_BLOCK {
+		return
+	}
+
+	<-c.slots
+}
+
+// acquire reports whether conn may be handled. Every successful acquire must be followed by release.
+func (c *connectionLimiter) acquire(conn net.Conn) bool {
+	if c == nil {
+		return true
+	}
+
+	if c.slots != nil && c.mode == CONNECTION_LIMIT_REJECT {
+		select {
+		case c.slots <- struct{}{}:
+		default:
+			return false
+		}
+	}
+
+	if c.maxPerIP > 0 {
+		ip := remoteIP(conn)
+
+		c.mu.Lock()
+		if c.activePerIP[ip] >= c.maxPerIP {
+			c.mu.Unlock()
+			c.releaseSlot()
+			return false
+		}
+		c.activePerIP[ip]++
+		c.mu.Unlock()
+	}
+
+	return true
+}
+
+func (c *connectionLimiter) release(conn net.Conn) {
+	if c == nil {
+		return
+	}
+
+	if c.maxPerIP > 0 {
+		ip := remoteIP(conn)
+
+		c.mu.Lock()
+		c.activePerIP[ip]--
+		if c.activePerIP[ip] <= 0 {
+			delete(c.activePerIP, ip)
+		}
+		c.mu.Unlock()
+	}
+
+	c.releaseSlot()
+}
+
+func (c *connectionLimiter) releaseSlot() {
+	if c.slots != nil {
+		<-c.slots
+	}
+}
+
+// rejectConnection answers a connection over the limit with 503 without reading the request
+func (s *Server) rejectConnection(conn net.Conn) {
+	defer conn.Close()
+
+	s.ErrorLogger.Warn("connection limit reached", "remote_addr", remoteAddr(conn))
+
+	conn.SetWriteDeadline(time.Now().Add(rejectWriteTimeout))
+	herr := &HandlerError{
+		StatusCode: response.SERVICE_UNAVAILABLE,
+		Message:    []byte("Too many connections"),
+	}
+	herr.Write(conn)
+
+	drainConnection(conn)
+}
+
+// drainConnection discards what the client already sent, closing with unread data would reset
+// the connection before the client gets to read the response
+func drainConnection(conn net.Conn) {
+	if closeWriter, ok := conn.(interface{ CloseWrite() error }); ok {
+		closeWriter.CloseWrite()
+	}
+	conn.SetReadDeadline(time.Now().Add(rejectDrainTimeout))
+	io.Copy(io.Discard, io.LimitReader(conn, rejectDrainLimit))
+}
+
+func remoteIP(conn net.Conn) string {
+	addr := remoteAddr(conn)
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
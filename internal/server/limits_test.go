@@ -0,0 +1,98 @@
+package server
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"httpfromtcp/internal/request"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func blockingHandler(started chan<- struct{}, release <-chan struct{}) Handler {
+	return func(w io.Writer, req *request.Request) *HandlerError {
+		started <- struct{}{}
+		<-release
+		w.Write([]byte("done"))
+		return nil
+	}
+}
+
+func sendRequest(t *testing.T, addr net.Addr) net.Conn {
+	conn, err := net.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	return conn
+}
+
+func readResponse(t *testing.T, conn net.Conn) string {
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	responseBytes, err := io.ReadAll(conn)
+	require.NoError(t, err)
+
+	return string(responseBytes)
+}
+
+func TestMaxConnections(t *testing.T) {
+	// Test: Reject mode answers 503 when full
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	srv, err := ServeAddress("127.0.0.1:0", blockingHandler(started, release), WithMaxConnections(1, CONNECTION_LIMIT_REJECT))
+	require.NoError(t, err)
+
+	first := sendRequest(t, srv.Addr())
+	<-started
+	assert.Contains(t, readResponse(t, sendRequest(t, srv.Addr())), "HTTP/1.1 503 Service Unavailable")
+	close(release)
+	assert.Contains(t, readResponse(t, first), "HTTP/1.1 200 OK")
+	require.NoError(t, srv.Close())
+
+	// Test: Block mode waits for a free slot
+	started = make(chan struct{}, 2)
+	release = make(chan struct{})
+	srv, err = ServeAddress("127.0.0.1:0", blockingHandler(started, release), WithMaxConnections(1, CONNECTION_LIMIT_BLOCK))
+	require.NoError(t, err)
+
+	first = sendRequest(t, srv.Addr())
+	<-started
+	second := sendRequest(t, srv.Addr())
+	select {
+	case <-started:
+		t.Fatal("second connection handled while the server was full")
+	case <-time.After(100 * time.Millisecond):
+	}
+	release <- struct{}{}
+	assert.Contains(t, readResponse(t, first), "HTTP/1.1 200 OK")
+	<-started
+	close(release)
+	assert.Contains(t, readResponse(t, second), "HTTP/1.1 200 OK")
+	require.NoError(t, srv.Close())
+}
+
+func TestMaxConnectionsPerIP(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	srv, err := ServeAddress("127.0.0.1:0", blockingHandler(started, release), WithMaxConnectionsPerIP(1))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	first := sendRequest(t, srv.Addr())
+	<-started
+	assert.Contains(t, readResponse(t, sendRequest(t, srv.Addr())), "HTTP/1.1 503 Service Unavailable")
+	close(release)
+	assert.Contains(t, readResponse(t, first), "HTTP/1.1 200 OK")
+
+	// Test: The slot is freed once the connection is done
+	assert.Eventually(t, func() bool {
+		srv.connectionLimiter.mu.Lock()
+		defer srv.connectionLimiter.mu.Unlock()
+		return len(srv.connectionLimiter.activePerIP) == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, readResponse(t, sendRequest(t, srv.Addr())), "HTTP/1.1 200 OK")
+}
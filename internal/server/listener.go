@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	UNIX_ADDRESS_PREFIX = "unix:"
+)
+
+var (
+	ERROR_NIL_LISTENER = fmt.Errorf("error: listener is nil")
+)
+
+// Listen opens a listener for address, which is either a TCP address such as "127.0.0.1:8080" or ":0",
+// or a Unix domain socket path prefixed with "unix:", e.g. "unix:/run/app.sock"
+func Listen(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, UNIX_ADDRESS_PREFIX) {
+		return net.Listen("tcp", address)
+	}
+
+	path := strings.TrimPrefix(address, UNIX_ADDRESS_PREFIX)
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	return net.Listen("unix", path)
+}
+
+// removeStaleSocket deletes a socket file left behind by a previous process that nobody listens on anymore
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("error: socket %s is already in use", path)
+	}
+
+	return os.Remove(path)
+}
+
+// ServeAddress is like Serve but listens on any address accepted by Listen
+func ServeAddress(address string, handler Handler, options ...Option) (*Server, error) {
+	listener, err := Listen(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return ServeListener(listener, handler, options...)
+}
+
+// ServeListener serves connections accepted by listener, which may be any net.Listener
+// including TLS and in-memory listeners. The server closes listener when it is closed.
+func ServeListener(listener net.Listener, handler Handler, options ...Option) (*Server, error) {
+	if listener == nil {
+		return nil, ERROR_NIL_LISTENER
+	}
+
+	return newServer(listener, handler, options...), nil
+}
+
+// Addr returns the address the server is bound to, which includes the real port when listening on port 0
+func (s *Server) Addr() net.Addr {
+	return s.Listener.Addr()
+}
+
+func remoteAddr(conn net.Conn) string {
+	addr := conn.RemoteAddr()
+	if addr == nil || addr.String() == "" {
+		return "-"
+	}
+
+	return addr.String()
+}
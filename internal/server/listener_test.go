@@ -0,0 +1,106 @@
+package server
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"httpfromtcp/internal/request"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pipeListener hands out in-memory connections created by Dial
+type pipeListener struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (p *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-p.conns:
+		return conn, nil
+	case <-p.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (p *pipeListener) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	return nil
+}
+
+func (p *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "pipe"}
+}
+
+func (p *pipeListener) Dial() net.Conn {
+	clientConn, serverConn := net.Pipe()
+	p.conns <- serverConn
+	return clientConn
+}
+
+func okHandler(w io.Writer, req *request.Request) *HandlerError {
+	w.Write([]byte("listening"))
+	return nil
+}
+
+func roundTrip(t *testing.T, conn net.Conn) string {
+	defer conn.Close()
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	responseBytes, err := io.ReadAll(conn)
+	require.NoError(t, err)
+
+	return string(responseBytes)
+}
+
+func TestServeListener(t *testing.T) {
+	// Test: TCP on port 0 reports the bound port
+	srv, err := ServeAddress("127.0.0.1:0", okHandler)
+	require.NoError(t, err)
+	addr := srv.Addr().String()
+	assert.True(t, strings.HasPrefix(addr, "127.0.0.1:"))
+	assert.NotEqual(t, "127.0.0.1:0", addr)
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	assert.Contains(t, roundTrip(t, conn), "listening")
+	require.NoError(t, srv.Close())
+
+	// Test: Unix domain socket
+	socketPath := filepath.Join(t.TempDir(), "app.sock")
+	srv, err = ServeAddress(UNIX_ADDRESS_PREFIX+socketPath, okHandler)
+	require.NoError(t, err)
+	assert.Equal(t, socketPath, srv.Addr().String())
+	conn, err = net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	assert.Contains(t, roundTrip(t, conn), "listening")
+
+	// Test: Socket in use is not removed
+	_, err = Listen(UNIX_ADDRESS_PREFIX + socketPath)
+	require.Error(t, err)
+	require.NoError(t, srv.Close())
+
+	// Test: In-memory listener
+	listener := newPipeListener()
+	srv, err = ServeListener(listener, okHandler)
+	require.NoError(t, err)
+	assert.Contains(t, roundTrip(t, listener.Dial()), "listening")
+	require.NoError(t, srv.Close())
+
+	// Test: nil listener
+	_, err = ServeListener(nil, okHandler)
+	require.ErrorIs(t, err, ERROR_NIL_LISTENER)
+}
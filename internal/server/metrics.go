@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"httpfromtcp/internal/request"
+)
+
+const (
+	METRICS_CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+	metricsNamespace     = "httpfromtcp"
+)
+
+var (
+	defaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	// standardMethods are the methods of RFC 9110 and PATCH
+	standardMethods = map[string]bool{
+		"GET": true, "HEAD": true, "POST": true, "PUT": true, "DELETE": true,
+		"CONNECT": true, "OPTIONS": true, "TRACE": true, "PATCH": true,
+	}
+)
+
+// Metrics collects server statistics and renders them in the Prometheus text exposition format.
+// Recording on a nil *Metrics is a no-op so the server does not need to check whether metrics are enabled.
+type Metrics struct {
+	activeConnections atomic.Int64
+	bytesReceived     atomic.Int64
+	bytesSent         atomic.Int64
+	parseErrors       atomic.Int64
+	hijacked          atomic.Int64
+
+	mu              sync.Mutex
+	requests        map[requestKey]uint64
+	deviations      map[request.Deviation]uint64
+	durationBuckets []float64
+	durationCounts  []uint64
+	durationSum     float64
+	durationCount   uint64
+}
+
+type requestKey struct {
+	method     string
+	statusCode int
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:        map[requestKey]uint64{},
+		deviations:      map[request.Deviation]uint64{},
+		durationBuckets: defaultDurationBuckets,
+		durationCounts:  make([]uint64, len(defaultDurationBuckets)),
+	}
+}
+
+// WithMetrics records server metrics and serves them on path, e.g. "/metrics"
+func WithMetrics(metrics *Metrics, path string) Option {
+	return func(s *Server) {
+		s.Metrics = metrics
+		s.MetricsPath = path
+	}
+}
+
+func (m *Metrics) connectionOpened() {
+	if m == nil {
+		return
+	}
+	m.activeConnections.Add(1)
+}
+
+func (m *Metrics) connectionClosed() {
+	if m == nil {
+		return
+	}
+	m.activeConnections.Add(-1)
+}
+
+// bytesRead and bytesWritten are counted as they pass, so long-lived connections show up
+// before they are closed
+func (m *Metrics) bytesRead(n int) {
+	if m == nil {
+		return
+	}
+	m.bytesReceived.Add(int64(n))
+}
+
+func (m *Metrics) bytesWritten(n int) {
+	if m == nil {
+		return
+	}
+	m.bytesSent.Add(int64(n))
+}
+
+func (m *Metrics) parseError() {
+	if m == nil {
+		return
+	}
+	m.parseErrors.Add(1)
+}
+
+func (m *Metrics) connectionHijacked() {
+	if m == nil {
+		return
+	}
+	m.hijacked.Add(1)
+}
+
+// observeDeviations counts a request accepted with the deviations of a lenient parser
+func (m *Metrics) observeDeviations(deviations []request.Deviation) {
+	if m == nil || len(deviations) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, deviation := range deviations {
+		m.deviations[deviation]++
+	}
+}
+
+func (m *Metrics) observeRequest(method string, statusCode int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// clients choose the method, only the standard ones get their own label value
+	if !standardMethods[method] {
+		method = "OTHER"
+	}
+	m.requests[requestKey{method: method, statusCode: statusCode}]++
+
+	seconds := duration.Seconds()
+	for i, bucket := range m.durationBuckets {
+		if seconds <= bucket {
+			m.durationCounts[i]++
+			break
+		}
+	}
+	m.durationSum += seconds
+	m.durationCount++
+}
+
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	buffer := bytes.NewBuffer([]byte{})
+
+	writeMetricHeader(buffer, "active_connections", "gauge", "Number of currently open client connections.")
+	fmt.Fprintf(buffer, "%s_active_connections %d\n", metricsNamespace, m.activeConnections.Load())
+
+	writeMetricHeader(buffer, "received_bytes_total", "counter", "Total bytes read from client connections.")
+	fmt.Fprintf(buffer, "%s_received_bytes_total %d\n", metricsNamespace, m.bytesReceived.Load())
+
+	writeMetricHeader(buffer, "sent_bytes_total", "counter", "Total bytes written to client connections.")
+	fmt.Fprintf(buffer, "%s_sent_bytes_total %d\n", metricsNamespace, m.bytesSent.Load())
+
+	writeMetricHeader(buffer, "parse_errors_total", "counter", "Total requests rejected because they could not be parsed.")
+	fmt.Fprintf(buffer, "%s_parse_errors_total %d\n", metricsNamespace, m.parseErrors.Load())
+
+	writeMetricHeader(buffer, "hijacked_connections_total", "counter", "Total connections taken over by handlers.")
+	fmt.Fprintf(buffer, "%s_hijacked_connections_total %d\n", metricsNamespace, m.hijacked.Load())
+
+	m.mu.Lock()
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].statusCode < keys[j].statusCode
+	})
+
+	writeMetricHeader(buffer, "requests_total", "counter", "Total requests handled by method and status code.")
+	for _, key := range keys {
+		fmt.Fprintf(buffer, "%s_requests_total{method=\"%s\",status=\"%d\"} %d\n",
+			metricsNamespace, escapeLabelValue(key.method), key.statusCode, m.requests[key])
+	}
+
+	deviations := slices.Sorted(maps.Keys(m.deviations))
+	writeMetricHeader(buffer, "lenient_requests_total", "counter", "Total requests accepted only by deviating from RFC 9112, by deviation.")
+	for _, deviation := range deviations {
+		fmt.Fprintf(buffer, "%s_lenient_requests_total{deviation=\"%s\"} %d\n",
+			metricsNamespace, escapeLabelValue(string(deviation)), m.deviations[deviation])
+	}
+
+	writeMetricHeader(buffer, "request_duration_seconds", "histogram", "Time spent handling requests.")
+	cumulativeCount := uint64(0)
+	for i, bucket := range m.durationBuckets {
+		cumulativeCount += m.durationCounts[i]
+		fmt.Fprintf(buffer, "%s_request_duration_seconds_bucket{le=\"%g\"} %d\n", metricsNamespace, bucket, cumulativeCount)
+	}
+	fmt.Fprintf(buffer, "%s_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", metricsNamespace, m.durationCount)
+	fmt.Fprintf(buffer, "%s_request_duration_seconds_sum %g\n", metricsNamespace, m.durationSum)
+	fmt.Fprintf(buffer, "%s_request_duration_seconds_count %d\n", metricsNamespace, m.durationCount)
+
+	m.mu.Unlock()
+
+	return buffer.WriteTo(w)
+}
+
+func writeMetricHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s_%s %s\n", metricsNamespace, name, help)
+	fmt.Fprintf(w, "# TYPE %s_%s %s\n", metricsNamespace, name, metricType)
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "\"", "\\\"")
+	return strings.ReplaceAll(value, "\n", "\\n")
+}
+
+// countingReader keeps track of how many bytes were read from the client
+type countingReader struct {
+	reader    io.Reader
+	bytesRead int64
+	metrics   *Metrics
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.bytesRead += int64(n)
+	c.metrics.bytesRead(n)
+
+	return n, err
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"httpfromtcp/internal/request"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsWriteTo(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.connectionOpened()
+	metrics.connectionOpened()
+	metrics.connectionClosed()
+	metrics.bytesRead(120)
+	metrics.bytesWritten(300)
+	metrics.parseError()
+	metrics.connectionHijacked()
+	metrics.observeRequest("GET", 200, 20*time.Millisecond)
+	metrics.observeRequest("GET", 200, 2*time.Second)
+	metrics.observeRequest("POST", 400, time.Millisecond)
+	metrics.observeRequest("BREW", 418, time.Millisecond)
+	metrics.observeRequest("WHEN", 418, time.Millisecond)
+	metrics.observeDeviations([]request.Deviation{request.DEVIATION_BARE_LF, request.DEVIATION_OBS_FOLD})
+	metrics.observeDeviations([]request.Deviation{request.DEVIATION_BARE_LF})
+	metrics.observeDeviations(nil)
+
+	buffer := &bytes.Buffer{}
+	_, err := metrics.WriteTo(buffer)
+	require.NoError(t, err)
+
+	output := buffer.String()
+	assert.Contains(t, output, "# TYPE httpfromtcp_active_connections gauge\nhttpfromtcp_active_connections 1\n")
+	assert.Contains(t, output, "httpfromtcp_received_bytes_total 120\n")
+	assert.Contains(t, output, "httpfromtcp_sent_bytes_total 300\n")
+	assert.Contains(t, output, "httpfromtcp_parse_errors_total 1\n")
+	assert.Contains(t, output, "httpfromtcp_hijacked_connections_total 1\n")
+	assert.Contains(t, output, "httpfromtcp_requests_total{method=\"GET\",status=\"200\"} 2\n")
+	assert.Contains(t, output, "httpfromtcp_requests_total{method=\"POST\",status=\"400\"} 1\n")
+	assert.Contains(t, output, "httpfromtcp_requests_total{method=\"OTHER\",status=\"418\"} 2\n")
+	assert.NotContains(t, output, "BREW")
+	assert.Contains(t, output, "httpfromtcp_request_duration_seconds_bucket{le=\"0.005\"} 3\n")
+	assert.Contains(t, output, "httpfromtcp_request_duration_seconds_bucket{le=\"0.025\"} 4\n")
+	assert.Contains(t, output, "httpfromtcp_request_duration_seconds_bucket{le=\"+Inf\"} 5\n")
+	assert.Contains(t, output, "httpfromtcp_request_duration_seconds_count 5\n")
+	assert.Contains(t, output, "httpfromtcp_lenient_requests_total{deviation=\"bare-lf\"} 2\n")
+	assert.Contains(t, output, "httpfromtcp_lenient_requests_total{deviation=\"obs-fold\"} 1\n")
+
+	// Test: nil metrics record nothing
+	var disabled *Metrics
+	disabled.connectionOpened()
+	disabled.observeRequest("GET", 200, time.Second)
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+const (
+	DEFAULT_PROXY_DIAL_TIMEOUT     = 10 * time.Second
+	DEFAULT_PROXY_RESPONSE_TIMEOUT = 30 * time.Second
+	DEFAULT_PROXY_IDLE_TIMEOUT     = 30 * time.Second
+	DEFAULT_PROXY_VIA              = "httpfromtcp"
+)
+
+var (
+	ERROR_UNSUPPORTED_UPSTREAM = fmt.Errorf("error: upstream has to be an http or https URL")
+
+	// hopByHopHeaders only concern a single connection and are never forwarded, see RFC 9110 section 7.6.1
+	hopByHopHeaders = []string{
+		"connection",
+		"keep-alive",
+		"proxy-connection",
+		"proxy-authenticate",
+		"proxy-authorization",
+		"te",
+		"trailer",
+		"transfer-encoding",
+		"upgrade",
+	}
+)
+
+// ReverseProxy forwards requests to Upstream and streams the responses back to the client
+type ReverseProxy struct {
+	Upstream *url.URL
+	// StripPrefix is removed from the request path before it is appended to the upstream path
+	StripPrefix string
+	// Via names the proxy in the Via header added to requests and responses
+	Via                   string
+	DialTimeout           time.Duration
+	ResponseHeaderTimeout time.Duration
+	// IdleTimeout limits the wait for each read of the upstream body
+	IdleTimeout time.Duration
+	// TLSConfig is used for https upstreams, the server name defaults to the upstream host
+	TLSConfig *tls.Config
+}
+
+func NewReverseProxy(upstream, stripPrefix string) (*ReverseProxy, error) {
+	upstreamURL, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+	if (upstreamURL.Scheme != "http" && upstreamURL.Scheme != "https") || upstreamURL.Host == "" {
+		return nil, ERROR_UNSUPPORTED_UPSTREAM
+	}
+
+	return &ReverseProxy{
+		Upstream:              upstreamURL,
+		StripPrefix:           stripPrefix,
+		Via:                   DEFAULT_PROXY_VIA,
+		DialTimeout:           DEFAULT_PROXY_DIAL_TIMEOUT,
+		ResponseHeaderTimeout: DEFAULT_PROXY_RESPONSE_TIMEOUT,
+		IdleTimeout:           DEFAULT_PROXY_IDLE_TIMEOUT,
+	}, nil
+}
+
+func (p *ReverseProxy) Handle(w io.Writer, req *request.Request) *HandlerError {
+	responseWriter, ok := w.(*ResponseWriter)
+	if !ok {
+		return internalError()
+	}
+	if herr := BodyError(req.ReadBody()); herr != nil {
+		return herr
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		return gatewayError(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(p.ResponseHeaderTimeout))
+	if err := p.upstreamRequest(req).Write(conn); err != nil {
+		return gatewayError(err)
+	}
+	upstream, err := readUpstreamResponse(bufio.NewReader(conn), req.RequestLine.Method)
+	if err != nil {
+		return gatewayError(err)
+	}
+
+	header := responseWriter.Header()
+	for name, value := range upstream.Headers {
+		header.Set(name, value)
+	}
+	removeHopByHopHeaders(header)
+	setForwardedLength(header, upstream, req.RequestLine.Method)
+	if trailer := upstream.Headers.Get("trailer"); trailer != "" && header.Get("content-length") == "" {
+		header.Set("trailer", trailer)
+	}
+	header.Set("via", appendHeaderValue(header.Get("via"), "1.1 "+p.Via))
+
+	if err := responseWriter.WriteHeader(upstream.StatusCode); err != nil {
+		return internalError()
+	}
+	body := &idleReader{reader: upstream.Body, conn: conn, timeout: p.IdleTimeout}
+	if _, err := io.Copy(responseWriter, body); err != nil && !errors.Is(err, ERROR_BODY_NOT_ALLOWED) {
+		return &HandlerError{
+			StatusCode: response.BAD_GATEWAY,
+			Message:    []byte(fmt.Sprintf("error streaming the upstream body: %v", err)),
+		}
+	}
+	for name, value := range upstream.Trailers {
+		responseWriter.Trailer().Set(name, value)
+	}
+
+	return nil
+}
+
+func (p *ReverseProxy) dial() (net.Conn, error) {
+	host := p.Upstream.Host
+	if p.Upstream.Port() == "" {
+		port := "80"
+		if p.Upstream.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(p.Upstream.Hostname(), port)
+	}
+
+	conn, err := net.DialTimeout("tcp", host, p.DialTimeout)
+	if err != nil || p.Upstream.Scheme != "https" {
+		return conn, err
+	}
+
+	config := &tls.Config{}
+	if p.TLSConfig != nil {
+		config = p.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = p.Upstream.Hostname()
+	}
+	tlsConn := tls.Client(conn, config)
+	tlsConn.SetDeadline(time.Now().Add(p.DialTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// upstreamRequest builds the request sent upstream, req with the forwarding headers added
+func (p *ReverseProxy) upstreamRequest(req *request.Request) *request.Request {
+	forwarded := headers.Headers{}
+	for name, value := range req.Headers {
+		forwarded.Set(name, value)
+	}
+	removeHopByHopHeaders(forwarded)
+	forwarded.Delete("expect")
+
+	forwarded.Set("host", p.Upstream.Host)
+	forwarded.Set("x-forwarded-host", req.Headers.Get("host"))
+	// unix socket and pipe clients have no address to forward
+	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil && clientIP != "" {
+		forwarded.Set("x-forwarded-for", appendHeaderValue(forwarded.Get("x-forwarded-for"), clientIP))
+	}
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	forwarded.Set("x-forwarded-proto", proto)
+	forwarded.Set("via", appendHeaderValue(forwarded.Get("via"), "1.1 "+p.Via))
+	forwarded.Set("connection", "close")
+
+	return &request.Request{
+		RequestLine: request.RequestLine{
+			Method:        req.RequestLine.Method,
+			RequestTarget: p.upstreamTarget(req.RequestLine.RequestTarget),
+			HttpVersion:   "1.1",
+		},
+		Headers: forwarded,
+		Body:    req.Body,
+	}
+}
+
+// upstreamTarget joins the upstream path and query with the ones of the request
+func (p *ReverseProxy) upstreamTarget(target string) string {
+	path, query, _ := strings.Cut(target, "?")
+	path = strings.TrimPrefix(path, p.StripPrefix)
+
+	upstreamPath := strings.TrimSuffix(p.Upstream.EscapedPath(), "/")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	path = upstreamPath + path
+
+	switch {
+	case p.Upstream.RawQuery != "" && query != "":
+		query = p.Upstream.RawQuery + "&" + query
+	case p.Upstream.RawQuery != "":
+		query = p.Upstream.RawQuery
+	}
+	if query != "" {
+		return path + "?" + query
+	}
+
+	return path
+}
+
+// readUpstreamResponse reads the final upstream response, skipping interim responses
+func readUpstreamResponse(reader *bufio.Reader, method string) (*response.Response, error) {
+	for {
+		upstream, err := response.ResponseFromReader(reader, method)
+		if err != nil || !upstream.Informational() {
+			return upstream, err
+		}
+	}
+}
+
+// removeHopByHopHeaders drops the hop-by-hop headers and the ones listed in Connection
+func removeHopByHopHeaders(h headers.Headers) {
+	for _, name := range strings.Split(h.Get("connection"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			deleteHeader(h, name)
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		deleteHeader(h, name)
+	}
+}
+
+func appendHeaderValue(existing, value string) string {
+	if existing == "" {
+		return value
+	}
+
+	return existing + ", " + value
+}
+
+// setForwardedLength makes the content-length of the response match the body the proxy
+// forwards. Chunked and close-delimited upstream bodies are sent chunked, so a content-length
+// the upstream sent along with them is dropped.
+func setForwardedLength(h headers.Headers, upstream *response.Response, method string) {
+	if upstream.Headers.Get("transfer-encoding") != "" {
+		h.Delete("content-length")
+	}
+	if method == "HEAD" || !bodyAllowed(upstream.StatusCode) {
+		// a HEAD response keeps the length of the body a GET would get
+		return
+	}
+	if upstream.ContentLength < 0 {
+		h.Delete("content-length")
+		return
+	}
+
+	h.Set("content-length", strconv.FormatInt(upstream.ContentLength, 10))
+}
+
+// idleReader fails a read of the upstream body once the upstream stayed silent for timeout
+type idleReader struct {
+	reader  io.Reader
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	if r.timeout > 0 {
+		r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+	} else {
+		r.conn.SetReadDeadline(time.Time{})
+	}
+
+	return r.reader.Read(p)
+}
+
+// gatewayError answers 504 when the upstream timed out and 502 for any other upstream failure
+func gatewayError(err error) *HandlerError {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &HandlerError{
+			StatusCode: response.GATEWAY_TIMEOUT,
+			Message:    []byte("Upstream timed out"),
+		}
+	}
+
+	return &HandlerError{
+		StatusCode: response.BAD_GATEWAY,
+		Message:    []byte(fmt.Sprintf("Upstream failed: %v", err)),
+	}
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubUpstream answers every connection with rawResponse and sends the raw requests it got on requests
+func stubUpstream(t *testing.T, rawResponse string) (net.Listener, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	requests := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				head := ""
+				for !strings.HasSuffix(head, "\r\n\r\n") {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					head += line
+				}
+				if strings.Contains(head, "content-length: 5\r\n") {
+					body := make([]byte, 5)
+					io.ReadFull(reader, body)
+					head += string(body)
+				}
+				requests <- head
+				if rawResponse != "" {
+					conn.Write([]byte(rawResponse))
+				} else {
+					io.Copy(io.Discard, conn)
+				}
+			}()
+		}
+	}()
+
+	return listener, requests
+}
+
+func proxyRequest(t *testing.T, srv *Server, rawRequest string) string {
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte(rawRequest))
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+
+	return string(out)
+}
+
+func TestReverseProxy(t *testing.T) {
+	upstream, requests := stubUpstream(t, "HTTP/1.1 201 Created\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Connection: close, X-Internal\r\n"+
+		"X-Internal: secret\r\n"+
+		"Keep-Alive: timeout=5\r\n"+
+		"X-Upstream: yes\r\n"+
+		"Trailer: X-Checksum\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"6\r\nstream\r\n5;ext=1\r\ned ok\r\n0\r\nX-Checksum: abc\r\n\r\n")
+
+	proxy, err := NewReverseProxy("http://"+upstream.Addr().String()+"/base?key=1", "/httpbin")
+	require.NoError(t, err)
+	srv, err := ServeAddress("127.0.0.1:0", proxy.Handle)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Test: Method, path, query, headers and body are forwarded with the hop-by-hop headers removed
+	out := proxyRequest(t, srv, "POST /httpbin/anything?a=b HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Connection: keep-alive, X-Hop\r\n"+
+		"X-Hop: 1\r\n"+
+		"Keep-Alive: timeout=5\r\n"+
+		"TE: trailers\r\n"+
+		"Proxy-Authorization: Basic abc\r\n"+
+		"X-Forwarded-For: 10.0.0.1\r\n"+
+		"X-Custom: kept\r\n"+
+		"Content-Length: 5\r\n"+
+		"\r\n"+
+		"hello")
+
+	forwarded := <-requests
+	assert.True(t, strings.HasPrefix(forwarded, "POST /base/anything?key=1&a=b HTTP/1.1\r\n"), forwarded)
+	assert.Contains(t, forwarded, "host: "+upstream.Addr().String()+"\r\n")
+	assert.Contains(t, forwarded, "x-custom: kept\r\n")
+	assert.Contains(t, forwarded, "x-forwarded-for: 10.0.0.1, 127.0.0.1\r\n")
+	assert.Contains(t, forwarded, "x-forwarded-proto: http\r\n")
+	assert.Contains(t, forwarded, "x-forwarded-host: example.com\r\n")
+	assert.Contains(t, forwarded, "via: 1.1 httpfromtcp\r\n")
+	assert.Contains(t, forwarded, "connection: close\r\n")
+	assert.True(t, strings.HasSuffix(forwarded, "\r\n\r\nhello"))
+	for _, hop := range []string{"x-hop", "keep-alive", "te:", "proxy-authorization"} {
+		assert.NotContains(t, forwarded, hop)
+	}
+
+	// Test: Status, headers, streamed body and trailers come back
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 201 Created\r\n"), out)
+	assert.Contains(t, out, "x-upstream:yes\r\n")
+	assert.Contains(t, out, "via:1.1 httpfromtcp\r\n")
+	assert.Contains(t, out, "trailer:X-Checksum\r\n")
+	assert.Contains(t, out, "transfer-encoding:chunked\r\n")
+	assert.NotContains(t, out, "x-internal")
+	assert.NotContains(t, out, "keep-alive")
+	_, body, _ := strings.Cut(out, "\r\n\r\n")
+	assert.Equal(t, "6\r\nstream\r\n5\r\ned ok\r\n0\r\nx-checksum:abc\r\n\r\n", body)
+
+	// Test: Clients without an IP address, e.g. on unix sockets, get no X-Forwarded-For
+	for _, remoteAddr := range []string{"@", "-", "/run/httpfromtcp.sock", ""} {
+		upstreamReq := proxy.upstreamRequest(&request.Request{
+			RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/httpbin/get", HttpVersion: "1.1"},
+			Headers:     headers.Headers{"host": "example.com"},
+			RemoteAddr:  remoteAddr,
+		})
+		assert.Empty(t, upstreamReq.Headers.Get("x-forwarded-for"), remoteAddr)
+	}
+
+	// Test: Chunked request bodies are forwarded with Content-Length
+	proxyRequest(t, srv, "PUT /httpbin/put HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"2\r\nhe\r\n3\r\nllo\r\n0\r\n\r\n")
+
+	forwarded = <-requests
+	assert.True(t, strings.HasPrefix(forwarded, "PUT /base/put?key=1 HTTP/1.1\r\n"), forwarded)
+	assert.NotContains(t, forwarded, "transfer-encoding")
+	assert.True(t, strings.HasSuffix(forwarded, "\r\n\r\nhello"))
+}
+
+func TestReverseProxyErrors(t *testing.T) {
+	// Test: Unreachable upstream
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	proxy, err := NewReverseProxy("http://"+closedAddr, "")
+	require.NoError(t, err)
+	srv, err := ServeAddress("127.0.0.1:0", proxy.Handle)
+	require.NoError(t, err)
+	defer srv.Close()
+	assert.Contains(t, proxyRequest(t, srv, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"), "HTTP/1.1 502 Bad Gateway\r\n")
+
+	// Test: Upstream that never answers
+	silent, _ := stubUpstream(t, "")
+	proxy.Upstream.Host = silent.Addr().String()
+	proxy.ResponseHeaderTimeout = 50 * time.Millisecond
+	assert.Contains(t, proxyRequest(t, srv, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"), "HTTP/1.1 504 Gateway Timeout\r\n")
+
+	// Test: Truncated upstream body
+	truncated, _ := stubUpstream(t, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort")
+	proxy.Upstream.Host = truncated.Addr().String()
+	proxy.ResponseHeaderTimeout = time.Second
+	out := proxyRequest(t, srv, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.True(t, strings.HasSuffix(out, "short"))
+
+	// Test: A Content-Length sent along a chunked upstream body is not forwarded
+	mixed, _ := stubUpstream(t, "HTTP/1.1 200 OK\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n")
+	proxy.Upstream.Host = mixed.Addr().String()
+	out = proxyRequest(t, srv, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.NotContains(t, out, "content-length")
+	assert.Contains(t, out, "transfer-encoding:chunked\r\n")
+	assert.True(t, strings.HasSuffix(out, "5\r\nhello\r\n0\r\n\r\n"), out)
+
+	// Test: Close-delimited upstream bodies are forwarded chunked
+	closeDelimited, _ := stubUpstream(t, "HTTP/1.1 200 OK\r\n\r\nhello")
+	proxy.Upstream.Host = closeDelimited.Addr().String()
+	out = proxyRequest(t, srv, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.NotContains(t, out, "content-length")
+	assert.True(t, strings.HasSuffix(out, "5\r\nhello\r\n0\r\n\r\n"), out)
+
+	// Test: An upstream that stalls while sending the body is given up after IdleTimeout
+	stalled, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer stalled.Close()
+	release := make(chan struct{})
+	defer close(release)
+	go func() {
+		conn, err := stalled.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nstart"))
+		<-release
+	}()
+	proxy.Upstream.Host = stalled.Addr().String()
+	proxy.IdleTimeout = 50 * time.Millisecond
+	started := time.Now()
+	out = proxyRequest(t, srv, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Less(t, time.Since(started), time.Second)
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.True(t, strings.HasSuffix(out, "start"))
+
+	// Test: Only http and https upstreams
+	_, err = NewReverseProxy("ftp://example.com", "")
+	assert.ErrorIs(t, err, ERROR_UNSUPPORTED_UPSTREAM)
+}
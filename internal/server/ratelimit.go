@@ -0,0 +1,145 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+const (
+	rateLimitSweepInterval = time.Minute
+)
+
+var (
+	ERROR_INVALID_RATE_LIMIT = fmt.Errorf("error: rate limits need a rate above 0 and a burst of at least 1")
+)
+
+// KeyFunc picks the bucket a request is counted against. Requests with an empty key are not limited.
+type KeyFunc func(req *request.Request) string
+
+// RateLimiter is a token bucket per key: every key may send burst requests at once and
+// then rate requests per second
+type RateLimiter struct {
+	rate    float64
+	burst   int
+	keyFunc KeyFunc
+	now     func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+func NewRateLimiter(rate float64, burst int, keyFunc KeyFunc) (*RateLimiter, error) {
+	if !(rate > 0) || math.IsInf(rate, 1) || burst < 1 {
+		return nil, ERROR_INVALID_RATE_LIMIT
+	}
+
+	return &RateLimiter{
+		rate:      rate,
+		burst:     burst,
+		keyFunc:   keyFunc,
+		now:       time.Now,
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+	}, nil
+}
+
+func KeyByRemoteIP(req *request.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+// KeyByHeader keys requests by the value of the header name, matched case-insensitively
+func KeyByHeader(name string) KeyFunc {
+	return func(req *request.Request) string {
+		return req.Headers.Get(name)
+	}
+}
+
+// Middleware answers requests over the limit with 429 instead of calling next
+func (r *RateLimiter) Middleware(next Handler) Handler {
+	return func(w io.Writer, req *request.Request) *HandlerError {
+		key := r.keyFunc(req)
+		if key == "" {
+			return next(w, req)
+		}
+
+		allowed, remaining, retryAfter := r.take(key)
+		if !allowed {
+			retryAfterSeconds := int(math.Ceil(retryAfter.Seconds()))
+			return &HandlerError{
+				StatusCode: response.TOO_MANY_REQUESTS,
+				Message:    []byte("Slow down, too many requests"),
+				Headers: headers.Headers{
+					"retry-after":         fmt.Sprintf("%d", retryAfterSeconds),
+					"ratelimit-limit":     fmt.Sprintf("%d", r.burst),
+					"ratelimit-remaining": fmt.Sprintf("%d", remaining),
+					"ratelimit-reset":     fmt.Sprintf("%d", retryAfterSeconds),
+				},
+			}
+		}
+
+		return next(w, req)
+	}
+}
+
+// take removes a token from the bucket of key. When the bucket is empty it returns
+// how long until the next token is available.
+func (r *RateLimiter) take(key string) (bool, int, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.sweep(now)
+
+	bucket, ok := r.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(r.burst), lastRefill: now}
+		r.buckets[key] = bucket
+	}
+
+	elapsed := now.Sub(bucket.lastRefill).Seconds()
+	bucket.tokens = math.Min(float64(r.burst), bucket.tokens+elapsed*r.rate)
+	bucket.lastRefill = now
+
+	if bucket.tokens < 1 {
+		missing := 1 - bucket.tokens
+		return false, 0, time.Duration(missing / r.rate * float64(time.Second))
+	}
+
+	bucket.tokens--
+
+	return true, int(bucket.tokens), 0
+}
+
+// sweep drops buckets that have refilled completely, they behave exactly like a missing bucket
+func (r *RateLimiter) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	r.lastSweep = now
+
+	refillTime := time.Duration(float64(r.burst) / r.rate * float64(time.Second))
+	for key, bucket := range r.buckets {
+		if now.Sub(bucket.lastRefill) >= refillTime {
+			delete(r.buckets, key)
+		}
+	}
+}
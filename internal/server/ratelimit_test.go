@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter, err := NewRateLimiter(1, 2, KeyByRemoteIP)
+	require.NoError(t, err)
+	limiter.now = func() time.Time { return now }
+	limiter.lastSweep = now
+
+	handler := limiter.Middleware(func(w io.Writer, req *request.Request) *HandlerError {
+		w.Write([]byte("ok"))
+		return nil
+	})
+	req := &request.Request{RemoteAddr: "10.0.0.1:5000", Headers: headers.Headers{}}
+	other := &request.Request{RemoteAddr: "10.0.0.2:5000", Headers: headers.Headers{}}
+
+	// Test: Burst is allowed
+	require.Nil(t, handler(&bytes.Buffer{}, req))
+	require.Nil(t, handler(&bytes.Buffer{}, req))
+
+	// Test: Bucket is empty
+	herr := handler(&bytes.Buffer{}, req)
+	require.NotNil(t, herr)
+	assert.Equal(t, 429, int(herr.StatusCode))
+	assert.Equal(t, "1", herr.Headers.Get("retry-after"))
+	assert.Equal(t, "2", herr.Headers.Get("ratelimit-limit"))
+	assert.Equal(t, "0", herr.Headers.Get("ratelimit-remaining"))
+
+	// Test: Other clients have their own bucket
+	require.Nil(t, handler(&bytes.Buffer{}, other))
+
+	// Test: Tokens refill over time
+	now = now.Add(time.Second)
+	require.Nil(t, handler(&bytes.Buffer{}, req))
+	require.NotNil(t, handler(&bytes.Buffer{}, req))
+
+	// Test: Idle buckets are evicted
+	now = now.Add(2 * rateLimitSweepInterval)
+	limiter.take("10.0.0.3")
+	assert.Len(t, limiter.buckets, 1)
+
+	// Test: Requests without key are not limited
+	headerLimiter, err := NewRateLimiter(1, 1, KeyByHeader("x-api-key"))
+	require.NoError(t, err)
+	byHeader := headerLimiter.Middleware(func(w io.Writer, req *request.Request) *HandlerError {
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		require.Nil(t, byHeader(&bytes.Buffer{}, req))
+	}
+
+	// Test: Header names match parsed headers whatever their case
+	headerLimiter, err = NewRateLimiter(1, 1, KeyByHeader("X-Api-Key"))
+	require.NoError(t, err)
+	byHeader = headerLimiter.Middleware(func(w io.Writer, req *request.Request) *HandlerError {
+		return nil
+	})
+	parsed, err := request.RequestFromReader(bytes.NewReader([]byte("GET / HTTP/1.1\r\nX-API-Key: secret\r\n\r\n")))
+	require.NoError(t, err)
+	require.Nil(t, byHeader(&bytes.Buffer{}, parsed))
+	herr = byHeader(&bytes.Buffer{}, parsed)
+	require.NotNil(t, herr)
+	assert.Equal(t, 429, int(herr.StatusCode))
+
+	// Test: Rates and bursts that would block or divide by zero are rejected
+	for _, limits := range []struct {
+		rate  float64
+		burst int
+	}{{0, 1}, {-1, 1}, {math.NaN(), 1}, {1, 0}, {1, -1}} {
+		_, err = NewRateLimiter(limits.rate, limits.burst, KeyByRemoteIP)
+		assert.ErrorIs(t, err, ERROR_INVALID_RATE_LIMIT, limits)
+	}
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/response"
+)
+
+var (
+	ERROR_HEADER_ALREADY_WRITTEN = fmt.Errorf("error: response header was already written")
+	ERROR_BODY_NOT_ALLOWED       = fmt.Errorf("error: response status does not allow a body")
+	ERROR_NOT_INFORMATIONAL      = fmt.Errorf("error: interim responses need a 1xx status code")
+	ERROR_NOT_HIJACKABLE         = fmt.Errorf("error: response writer has no connection to hijack")
+	ERROR_ALREADY_HIJACKED       = fmt.Errorf("error: connection was already hijacked")
+)
+
+// ResponseWriter is the io.Writer handed to handlers. A handler that only writes gets the default
+// response built from everything it wrote. A handler that needs its own status code or headers
+// type asserts the writer, fills in Header and calls WriteHeader, after which every write is
+// streamed to the client, framed by Content-Length when set and chunked otherwise.
+type ResponseWriter struct {
+	conn        io.Writer
+	header      headers.Headers
+	statusCode  response.StatusCode
+	wroteHeader bool
+	chunked     bool
+	buffer      bytes.Buffer
+	// suppressBody drops the body of HEAD responses while keeping their headers
+	suppressBody bool
+	// negotiateEncoding picks the content coding of the body, see Server.negotiateCompression
+	negotiateEncoding func(responseHeaders headers.Headers, length int64) string
+	encoder           io.WriteCloser
+	// netConn is handed out by Hijack, after which the server leaves the connection alone
+	netConn  net.Conn
+	buffered func() []byte
+	// trailer is sent after the last chunk of chunked bodies
+	trailer  headers.Headers
+	hijacked bool
+	// eventStream is closed by finish, so no keep-alive is written after the last chunk
+	eventStream *EventStream
+}
+
+// Hijacker is implemented by the writer handed to handlers, type assert it to take over the connection
+type Hijacker interface {
+	Hijack() (net.Conn, []byte, error)
+}
+
+func newResponseWriter(conn io.Writer) *ResponseWriter {
+	return &ResponseWriter{
+		conn:    conn,
+		header:  headers.Headers{},
+		trailer: headers.Headers{},
+	}
+}
+
+// Header returns the headers sent by WriteHeader, use headers.Headers.Set to fill them
+func (w *ResponseWriter) Header() headers.Headers {
+	return w.header
+}
+
+// Trailer returns the fields sent after a chunked body, they can be set until the handler returns.
+// Announce them in the Trailer header, responses with a Content-Length drop them.
+func (w *ResponseWriter) Trailer() headers.Headers {
+	return w.trailer
+}
+
+// Hijack hands the connection over to the handler, e.g. after a 101 Switching Protocols, along
+// with the bytes the server already read past the request, which have to be consumed before
+// reading from the connection. The server neither writes to, reads from nor closes it afterwards.
+func (w *ResponseWriter) Hijack() (net.Conn, []byte, error) {
+	if w.hijacked {
+		return nil, nil, ERROR_ALREADY_HIJACKED
+	}
+	if w.netConn == nil {
+		return nil, nil, ERROR_NOT_HIJACKABLE
+	}
+
+	w.hijacked = true
+	w.netConn.SetDeadline(time.Time{})
+
+	var buffered []byte
+	if w.buffered != nil {
+		buffered = w.buffered()
+	}
+
+	return w.netConn, buffered, nil
+}
+
+// WriteInformational sends an interim 1xx response, e.g. 103 Early Hints with the Link headers
+// of resources the client can start loading, any number of them may precede WriteHeader
+func (w *ResponseWriter) WriteInformational(statusCode response.StatusCode, h headers.Headers) error {
+	if w.wroteHeader {
+		return ERROR_HEADER_ALREADY_WRITTEN
+	}
+	if statusCode < 100 || statusCode > 199 || statusCode == response.SWITCHING_PROTOCOLS {
+		return ERROR_NOT_INFORMATIONAL
+	}
+
+	var writer response.Writer
+	if err := writer.WriteStatusLine(statusCode); err != nil {
+		return err
+	}
+	writer.WriteHeaders(h)
+
+	_, err := w.conn.Write(append(writer.StatusLine, writer.Headers...))
+	return err
+}
+
+func (w *ResponseWriter) WriteHeader(statusCode response.StatusCode) error {
+	if w.wroteHeader {
+		return ERROR_HEADER_ALREADY_WRITTEN
+	}
+
+	var writer response.Writer
+	if err := writer.WriteStatusLine(statusCode); err != nil {
+		return err
+	}
+
+	w.wroteHeader = true
+	w.statusCode = statusCode
+
+	if w.header.Get("connection") == "" {
+		w.header.Set("connection", "close")
+	}
+	if statusCode < 200 || statusCode == 204 {
+		// RFC 9110 section 8.6, these responses must not carry a Content-Length
+		w.header.Delete("content-length")
+	}
+	if bodyAllowed(statusCode) && w.negotiateEncoding != nil {
+		length, err := strconv.ParseInt(w.header.Get("content-length"), 10, 64)
+		if err != nil {
+			length = -1
+		}
+		if encoding := w.negotiateEncoding(w.header, length); encoding != "" {
+			markCompressed(w.header, encoding)
+			deleteHeader(w.header, "content-length")
+			w.encoder = newEncoder(encoding, bodyWriter{w})
+		}
+	}
+	if bodyAllowed(statusCode) && w.header.Get("content-length") == "" {
+		w.header.Set("transfer-encoding", "chunked")
+		w.chunked = true
+	}
+	writer.WriteHeaders(w.header)
+
+	if _, err := w.conn.Write(writer.StatusLine); err != nil {
+		return err
+	}
+	_, err := w.conn.Write(writer.Headers)
+
+	return err
+}
+
+func (w *ResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		return w.buffer.Write(p)
+	}
+	if !bodyAllowed(w.statusCode) {
+		return 0, ERROR_BODY_NOT_ALLOWED
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+
+	return w.writeBody(p)
+}
+
+// writeBody frames p as the body after any content coding was applied
+func (w *ResponseWriter) writeBody(p []byte) (int, error) {
+	if w.suppressBody {
+		return len(p), nil
+	}
+	if !w.chunked {
+		return w.conn.Write(p)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if _, err := fmt.Fprintf(w.conn, "%x\r\n", len(p)); err != nil {
+		return 0, err
+	}
+	n, err := w.conn.Write(p)
+	if err != nil {
+		return n, err
+	}
+	_, err = w.conn.Write([]byte("\r\n"))
+
+	return n, err
+}
+
+// finish flushes the content coding and terminates a chunked body once the handler returned
+func (w *ResponseWriter) finish() error {
+	if w.eventStream != nil {
+		w.eventStream.Close()
+	}
+	if w.encoder != nil {
+		if err := w.encoder.Close(); err != nil {
+			return err
+		}
+	}
+	if !w.chunked || w.suppressBody {
+		return nil
+	}
+
+	var writer response.Writer
+	writer.WriteTrailers(w.trailer)
+	_, err := w.conn.Write(append([]byte("0\r\n"), writer.Trailers...))
+
+	return err
+}
+
+// bodyWriter lets the content coding write to the framed body
+type bodyWriter struct {
+	w *ResponseWriter
+}
+
+func (b bodyWriter) Write(p []byte) (int, error) {
+	return b.w.writeBody(p)
+}
+
+// bodyAllowed reports whether a response with statusCode may have a body, see RFC 9110 section 6.4.1
+func bodyAllowed(statusCode response.StatusCode) bool {
+	return statusCode >= 200 && statusCode != 204 && statusCode != 304
+}
+
+// mergeHeaders copies src into dst under lowercased names, replacing values whose names only
+// differ in case
+func mergeHeaders(dst, src headers.Headers) {
+	for srcName, value := range src {
+		deleteHeader(dst, srcName)
+		dst.Set(srcName, value)
+	}
+}
+
+// deleteHeader removes name from h whatever its case
+func deleteHeader(h headers.Headers, name string) {
+	for existing := range h {
+		if strings.EqualFold(existing, name) {
+			delete(h, existing)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+// Router dispatches requests to the handler registered for their path and method.
+// Patterns ending with "/" match every path below them, the longest pattern wins.
+// HEAD is served by the GET handler and OPTIONS is answered from the registered methods.
+type Router struct {
+	routes []route
+	// NotFound handles paths without any route, a 404 is returned when it is nil
+	NotFound Handler
+}
+
+type route struct {
+	pattern string
+	methods map[string]Handler
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for pattern and each of methods
+func (r *Router) Handle(pattern string, handler Handler, methods ...string) {
+	for i := range r.routes {
+		if r.routes[i].pattern == pattern {
+			for _, method := range methods {
+				r.routes[i].methods[method] = handler
+			}
+			return
+		}
+	}
+
+	newRoute := route{pattern: pattern, methods: map[string]Handler{}}
+	for _, method := range methods {
+		newRoute.methods[method] = handler
+	}
+	r.routes = append(r.routes, newRoute)
+
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return len(r.routes[i].pattern) > len(r.routes[j].pattern)
+	})
+}
+
+func (r *Router) Serve(w io.Writer, req *request.Request) *HandlerError {
+	method := req.RequestLine.Method
+
+	if req.RequestLine.RequestTarget == "*" {
+		if method == "OPTIONS" {
+			return writeAllow(w, r.AllowedMethods(""))
+		}
+		return &HandlerError{
+			StatusCode: response.BAD_REQUEST,
+			Message:    []byte("Only OPTIONS can target *"),
+		}
+	}
+
+	path, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	matched := r.match(path)
+	if matched == nil {
+		if r.NotFound != nil {
+			return r.NotFound(w, req)
+		}
+		return notFoundError()
+	}
+
+	if handler, ok := matched.methods[method]; ok {
+		return handler(w, req)
+	}
+	if handler, ok := matched.methods["GET"]; ok && method == "HEAD" {
+		return handler(w, req)
+	}
+	if method == "OPTIONS" {
+		return writeAllow(w, r.AllowedMethods(path))
+	}
+
+	return &HandlerError{
+		StatusCode: response.METHOD_NOT_ALLOWED,
+		Message:    []byte("Method not allowed"),
+		Headers:    headers.Headers{"allow": strings.Join(r.AllowedMethods(path), ", ")},
+	}
+}
+
+// AllowedMethods lists the methods path can be requested with, every registered
+// method of the router when path is empty
+func (r *Router) AllowedMethods(path string) []string {
+	methods := map[string]bool{"OPTIONS": true}
+
+	for i := range r.routes {
+		if path != "" && &r.routes[i] != r.match(path) {
+			continue
+		}
+		for method := range r.routes[i].methods {
+			methods[method] = true
+			if method == "GET" {
+				methods["HEAD"] = true
+			}
+		}
+	}
+
+	allowed := make([]string, 0, len(methods))
+	for method := range methods {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+
+	return allowed
+}
+
+func (r *Router) match(path string) *route {
+	for i := range r.routes {
+		pattern := r.routes[i].pattern
+		if path == pattern || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern)) {
+			return &r.routes[i]
+		}
+	}
+
+	return nil
+}
+
+// writeAllow answers OPTIONS with 204 and the Allow header
+func writeAllow(w io.Writer, methods []string) *HandlerError {
+	responseWriter, ok := w.(*ResponseWriter)
+	if !ok {
+		return internalError()
+	}
+
+	responseWriter.Header().Set("allow", strings.Join(methods, ", "))
+	if err := responseWriter.WriteHeader(response.NO_CONTENT); err != nil {
+		return internalError()
+	}
+
+	return nil
+}
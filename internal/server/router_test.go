@@ -0,0 +1,91 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"httpfromtcp/internal/request"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sendRawRequest(t *testing.T, listener *pipeListener, rawRequest string) string {
+	conn := listener.Dial()
+	defer conn.Close()
+	_, err := conn.Write([]byte(rawRequest))
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+
+	return string(out)
+}
+
+func TestRouter(t *testing.T) {
+	router := NewRouter()
+	router.Handle("/coffee", func(w io.Writer, req *request.Request) *HandlerError {
+		w.Write([]byte("coffee"))
+		return nil
+	}, "GET", "POST")
+	router.Handle("/files/", func(w io.Writer, req *request.Request) *HandlerError {
+		responseWriter := w.(*ResponseWriter)
+		responseWriter.Header().Set("content-length", "5")
+		responseWriter.WriteHeader(200)
+		w.Write([]byte("files"))
+		return nil
+	}, "GET")
+	router.Handle("/files/upload", func(w io.Writer, req *request.Request) *HandlerError {
+		w.Write([]byte("uploaded"))
+		return nil
+	}, "PUT")
+
+	listener := newPipeListener()
+	srv, err := ServeListener(listener, router.Serve)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Test: Routing by path and method
+	assert.Contains(t, sendRawRequest(t, listener, "POST /coffee HTTP/1.1\r\nHost: localhost\r\n\r\n"), "coffee")
+	assert.Contains(t, sendRawRequest(t, listener, "GET /files/a/b HTTP/1.1\r\nHost: localhost\r\n\r\n"), "files")
+	assert.Contains(t, sendRawRequest(t, listener, "PUT /files/upload HTTP/1.1\r\nHost: localhost\r\n\r\n"), "uploaded")
+	assert.Contains(t, sendRawRequest(t, listener, "GET /tea HTTP/1.1\r\nHost: localhost\r\n\r\n"), "HTTP/1.1 404 Not Found\r\n")
+
+	// Test: Wrong method
+	out := sendRawRequest(t, listener, "DELETE /coffee HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 405 Method Not Allowed\r\n")
+	assert.Contains(t, out, "allow:GET, HEAD, OPTIONS, POST\r\n")
+
+	// Test: HEAD of a buffered response keeps Content-Length without a body
+	get := sendRawRequest(t, listener, "GET /coffee HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	head := sendRawRequest(t, listener, "HEAD /coffee HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	_, getBody, _ := strings.Cut(get, "\r\n\r\n")
+	assert.Contains(t, head, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, head, fmt.Sprintf("content-length:%d\r\n", len(getBody)))
+	assert.True(t, strings.HasSuffix(head, "\r\n\r\n"))
+	assert.NotContains(t, head, "coffee")
+
+	// Test: HEAD of a streamed response
+	head = sendRawRequest(t, listener, "HEAD /files/x HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, head, "content-length:5\r\n")
+	assert.True(t, strings.HasSuffix(head, "\r\n\r\n"))
+	assert.NotContains(t, head, "files")
+
+	// Test: HEAD of an error
+	head = sendRawRequest(t, listener, "HEAD /tea HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, head, "HTTP/1.1 404 Not Found\r\n")
+	assert.True(t, strings.HasSuffix(head, "\r\n\r\n"))
+
+	// Test: OPTIONS lists the methods of the path
+	out = sendRawRequest(t, listener, "OPTIONS /files/upload HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 204 No Content\r\n")
+	assert.Contains(t, out, "allow:OPTIONS, PUT\r\n")
+	assert.NotContains(t, out, "content-length")
+
+	// Test: OPTIONS * lists every method
+	out = sendRawRequest(t, listener, "OPTIONS * HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 204 No Content\r\n")
+	assert.Contains(t, out, "allow:GET, HEAD, OPTIONS, POST, PUT\r\n")
+	assert.NotContains(t, out, "content-length")
+}
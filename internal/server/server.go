@@ -2,48 +2,113 @@ package server
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"httpfromtcp/internal/headers"
 	"httpfromtcp/internal/request"
 	"httpfromtcp/internal/response"
 	"io"
+	"log/slog"
+	"mime"
 	"net"
 	"strings"
 	"sync/atomic"
+	"time"
 )
 
 type Server struct {
 	IsTerminated atomic.Bool
 	Listener     net.Listener
 	Handler      Handler
+	AccessLogger *slog.Logger
+	ErrorLogger  *slog.Logger
+	Metrics      *Metrics
+	MetricsPath  string
+	// ETags adds a strong ETag to buffered responses and answers conditional requests for them
+	ETags bool
+	// MaxDecodedBodySize enables decoding of gzip and deflate request bodies, see WithRequestDecoding
+	MaxDecodedBodySize int64
+	// Compression enables gzip and deflate, see WithCompression
+	Compression        bool
+	CompressionMinSize int
+	// Leniency lists the deviations from RFC 9112 accepted from clients, see WithLeniency
+	Leniency request.Leniency
+
+	connectionLimiter *connectionLimiter
+	onClose           []func()
 }
 
+type Option func(*Server)
+
 type HandlerError struct {
 	StatusCode response.StatusCode
 	Message    []byte
+	// Headers are sent in addition to the default headers
+	Headers headers.Headers
 }
 
+// Handler answers req. The server reads the body into req.Body before calling it, except for
+// requests with "Expect: 100-continue": the handler decides whether it wants their body, which
+// stays unread and req.Body empty until it calls req.ReadBody, sending "100 Continue". Neither
+// are multipart/form-data bodies read, so req.ParseMultipartForm can stream them however large
+// they are. Handlers using the body should call ReadBody, it does nothing once the body was read.
 type Handler func(w io.Writer, req *request.Request) *HandlerError
 
-func Serve(port int, handler Handler) (*Server, error) {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		return nil, err
-	}
-
-	var isTerminated atomic.Bool
-	isTerminated.Store(false)
+func Serve(port int, handler Handler, options ...Option) (*Server, error) {
+	return ServeAddress(fmt.Sprintf(":%d", port), handler, options...)
+}
 
+// New builds a server that is not listening yet, its requests can be served with ServeRequest
+func New(handler Handler, options ...Option) *Server {
 	server := &Server{
-		IsTerminated: isTerminated,
-		Listener:     listener,
-		Handler:      handler,
+		Handler:     handler,
+		ErrorLogger: slog.Default(),
 	}
+	for _, option := range options {
+		option(server)
+	}
+
+	return server
+}
+
+func newServer(listener net.Listener, handler Handler, options ...Option) *Server {
+	server := New(handler, options...)
+	server.Listener = listener
 
 	go server.listen()
 
-	return server, nil
+	return server
+}
+
+// WithAccessLogger logs every handled request to logger, see NewAccessLogger
+func WithAccessLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.AccessLogger = logger
+	}
+}
+
+// WithETags enables ETags and conditional requests for buffered responses
+func WithETags() Option {
+	return func(s *Server) {
+		s.ETags = true
+	}
+}
+
+// WithLeniency accepts and normalises the deviations enabled in leniency instead of rejecting
+// the requests using them, the deviations are counted by the metrics and logged with the access log
+func WithLeniency(leniency request.Leniency) Option {
+	return func(s *Server) {
+		s.Leniency = leniency
+	}
+}
+
+// WithErrorLogger replaces slog.Default() as the destination of server errors
+func WithErrorLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.ErrorLogger = logger
+	}
 }
 
 func (s *Server) Close() error {
@@ -52,6 +117,13 @@ func (s *Server) Close() error {
 	}
 
 	s.IsTerminated.Store(true)
+	for _, onClose := range s.onClose {
+		onClose()
+	}
+
+	if s.Listener == nil {
+		return nil
+	}
 	err := s.Listener.Close()
 	if err != nil {
 		return err
@@ -62,114 +134,380 @@ func (s *Server) Close() error {
 
 func (s *Server) listen() {
 	for {
+		if !s.connectionLimiter.wait() {
+			return
+		}
+
 		accept, err := s.Listener.Accept()
 		if err != nil {
+			s.connectionLimiter.cancelWait()
 			return
 		}
 
-		go s.handle(accept)
+		if !s.connectionLimiter.acquire(accept) {
+			go s.rejectConnection(accept)
+			continue
+		}
+
+		go func() {
+			defer s.connectionLimiter.release(accept)
+			s.handle(accept)
+		}()
 	}
 }
 
 func (s *Server) handle(conn net.Conn) {
+	start := time.Now()
+	writer := &countingWriter{writer: conn, metrics: s.Metrics}
+	reader := &countingReader{reader: conn, metrics: s.Metrics}
+
+	s.Metrics.connectionOpened()
+	defer s.Metrics.connectionClosed()
+
+	responseWriter := newResponseWriter(writer)
+	responseWriter.netConn = conn
+	defer func() {
+		if !responseWriter.hijacked {
+			conn.Close()
+		}
+	}()
 
-	req, err := request.RequestFromReader(conn)
-
-	defer conn.Close()
+	body := &continueReader{reader: reader}
+	req, err := request.RequestHeadFromReader(body, request.WithLeniency(s.Leniency))
 	if err != nil {
-		fmt.Printf("error:%s", err.Error())
+		s.ErrorLogger.Error("error parsing request", "remote_addr", remoteAddr(conn), "error", err)
+		s.Metrics.parseError()
+
+		herr := BodyError(err)
+		herr.Write(writer)
+		s.logAccess(conn, nil, herr.StatusCode, writer.bytesWritten, start)
+		return
+	}
 
-		herr := &HandlerError{
+	req.RemoteAddr = remoteAddr(conn)
+	s.Metrics.observeDeviations(req.Deviations)
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		connectionState := tlsConn.ConnectionState()
+		req.TLS = &connectionState
+	}
+	req.MaxDecodedBodySize = s.MaxDecodedBodySize
+	responseWriter.buffered = req.Buffered
+
+	var statusCode response.StatusCode
+	if herr := s.prepareRequestBody(req, body, responseWriter); herr != nil {
+		herr.writeResponse(writer, isBodyAllowed(req))
+		statusCode = herr.StatusCode
+	} else if s.isMetricsRequest(req) {
+		statusCode = s.handleMetricsResponse(writer)
+	} else {
+		statusCode = s.handleNormalResponse(responseWriter, req)
+	}
+
+	s.Metrics.observeRequest(req.RequestLine.Method, int(statusCode), time.Since(start))
+	s.logAccess(conn, req, statusCode, writer.bytesWritten, start)
+
+	if req.State != request.REQUEST_STATE_DONE && !responseWriter.hijacked {
+		// the handler answered without reading the body the client may still be sending
+		drainConnection(conn)
+	}
+}
+
+// WithRequestDecoding decodes gzip and deflate request bodies before they reach the handler,
+// rejecting bodies that decode to more than maxSize bytes
+func WithRequestDecoding(maxSize int64) Option {
+	return func(s *Server) {
+		s.MaxDecodedBodySize = maxSize
+	}
+}
+
+// prepareRequestBody reads the body before the handler runs, except for requests with
+// "Expect: 100-continue" whose body is only asked for once the handler calls ReadBody, and
+// multipart forms, see Handler
+func (s *Server) prepareRequestBody(req *request.Request, body *continueReader, w *ResponseWriter) *HandlerError {
+	expect := req.Headers.Get("expect")
+	switch {
+	case expect == "" && isMultipartForm(req):
+		return nil
+	case expect == "":
+		herr := BodyError(req.ReadBody())
+		if herr != nil && herr.StatusCode == response.BAD_REQUEST {
+			s.ErrorLogger.Error("error parsing request body", "remote_addr", req.RemoteAddr, "error", string(herr.Message))
+			s.Metrics.parseError()
+		}
+		return herr
+	case strings.EqualFold(expect, "100-continue"):
+		body.responseWriter = w
+		return nil
+	default:
+		return &HandlerError{
+			StatusCode: response.EXPECTATION_FAILED,
+			Message:    []byte(fmt.Sprintf("Unsupported expectation %q", expect)),
+		}
+	}
+}
+
+// isMultipartForm reports whether req has a multipart/form-data body, which is left for the
+// handler to stream
+func isMultipartForm(req *request.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(req.Headers.Get("content-type"))
+
+	return mediaType == "multipart/form-data"
+}
+
+// BodyError maps an error returned by Request.ReadBody and the form and JSON helpers, or by
+// RequestHeadFromReader, to the response telling the client what was wrong with the request,
+// it returns nil for a nil error
+func BodyError(err error) *HandlerError {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, request.ERROR_UNSUPPORTED_CONTENT_ENCODING):
+		return &HandlerError{
+			StatusCode: response.UNSUPPORTED_MEDIA_TYPE,
+			Message:    []byte(err.Error()),
+			Headers:    headers.Headers{"accept-encoding": "gzip, deflate"},
+		}
+	case errors.Is(err, request.ERROR_UNSUPPORTED_CONTENT_TYPE):
+		return &HandlerError{
+			StatusCode: response.UNSUPPORTED_MEDIA_TYPE,
+			Message:    []byte(err.Error()),
+		}
+	case errors.Is(err, request.ERROR_DECODED_BODY_TOO_LARGE), errors.Is(err, request.ERROR_BODY_TOO_LARGE),
+		errors.Is(err, request.ERROR_FORM_TOO_LARGE):
+		return &HandlerError{
+			StatusCode: response.CONTENT_TOO_LARGE,
+			Message:    []byte(err.Error()),
+		}
+	case errors.Is(err, request.ERROR_HEADER_TOO_LARGE):
+		return &HandlerError{
+			StatusCode: response.REQUEST_HEADER_FIELDS_TOO_LARGE,
+			Message:    []byte(err.Error()),
+		}
+	default:
+		return &HandlerError{
 			StatusCode: response.BAD_REQUEST,
 			Message:    []byte(err.Error()),
 		}
-		herr.Write(conn)
+	}
+}
+
+// continueReader sends "100 Continue" the first time the body of a request with
+// "Expect: 100-continue" is read, unless the final response was already started
+type continueReader struct {
+	reader         io.Reader
+	responseWriter *ResponseWriter
+}
+
+func (c *continueReader) Read(p []byte) (int, error) {
+	if w := c.responseWriter; w != nil {
+		c.responseWriter = nil
+		if !w.wroteHeader {
+			if err := w.WriteInformational(response.CONTINUE, nil); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return c.reader.Read(p)
+}
+
+// ServeRequest writes the response to an already parsed req to w the way a connection gets it,
+// leaving out connection handling such as Expect, hijacking and closing. See package servertest.
+func (s *Server) ServeRequest(w io.Writer, req *request.Request) response.StatusCode {
+	req.MaxDecodedBodySize = s.MaxDecodedBodySize
+	var err error
+	if !isMultipartForm(req) {
+		err = req.ReadBody()
+	}
+	if err == nil && s.MaxDecodedBodySize > 0 && req.State == request.REQUEST_STATE_DONE {
+		// ReadBody does not decode a body read before, e.g. by RequestFromReader
+		err = req.DecodeBody(s.MaxDecodedBodySize)
+	}
+	if herr := BodyError(err); herr != nil {
+		herr.writeResponse(w, isBodyAllowed(req))
+		return herr.StatusCode
+	}
+	if s.isMetricsRequest(req) {
+		return s.handleMetricsResponse(w)
+	}
+
+	return s.handleNormalResponse(newResponseWriter(w), req)
+}
+
+func (s *Server) isMetricsRequest(req *request.Request) bool {
+	if s.Metrics == nil || s.MetricsPath == "" {
+		return false
+	}
+
+	path, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	return path == s.MetricsPath
+}
+
+func (s *Server) handleMetricsResponse(conn io.Writer) response.StatusCode {
+	var writer response.Writer
+
+	body := bytes.NewBuffer([]byte{})
+	s.Metrics.WriteTo(body)
+	writer.Body = body.Bytes()
+
+	metricsHeaders := response.GetDefaultHeaders(len(writer.Body))
+	metricsHeaders.Set("content-type", METRICS_CONTENT_TYPE)
+
+	writer.WriteStatusLine(response.OK)
+	writer.WriteHeaders(metricsHeaders)
+
+	conn.Write(writer.StatusLine)
+	conn.Write(writer.Headers)
+	conn.Write(writer.Body)
+
+	return response.OK
+}
+
+func (s *Server) logAccess(conn net.Conn, req *request.Request, statusCode response.StatusCode, bytesWritten int64, start time.Time) {
+	if s.AccessLogger == nil {
 		return
 	}
 
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin/") {
-		s.handleChunkedResponse(conn, req)
-	} else {
-		s.handleNormalResponse(conn, req)
+	attrs := []slog.Attr{
+		slog.String(ACCESS_LOG_REMOTE_ADDR, remoteAddr(conn)),
+		slog.Int(ACCESS_LOG_STATUS, int(statusCode)),
+		slog.Int64(ACCESS_LOG_BYTES, bytesWritten),
+		slog.Duration(ACCESS_LOG_DURATION, time.Since(start)),
+	}
+	if req != nil {
+		attrs = append(attrs,
+			slog.String(ACCESS_LOG_METHOD, req.RequestLine.Method),
+			slog.String(ACCESS_LOG_TARGET, req.RequestLine.RequestTarget),
+			slog.String(ACCESS_LOG_PROTO, "HTTP/"+req.RequestLine.HttpVersion),
+			slog.String(ACCESS_LOG_USER_AGENT, req.Headers["user-agent"]),
+			slog.String(ACCESS_LOG_REFERER, req.Headers["referer"]),
+		)
+		if len(req.Deviations) > 0 {
+			attrs = append(attrs, slog.Any(ACCESS_LOG_DEVIATIONS, req.Deviations))
+		}
 	}
 
+	s.AccessLogger.LogAttrs(context.Background(), slog.LevelInfo, accessLogMessage, attrs...)
+}
+
+// countingWriter keeps track of how many bytes were sent to the client
+type countingWriter struct {
+	writer       io.Writer
+	bytesWritten int64
+	metrics      *Metrics
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.bytesWritten += int64(n)
+	c.metrics.bytesWritten(n)
+
+	return n, err
 }
 
 func (h *HandlerError) Write(conn io.Writer) {
+	h.writeResponse(conn, true)
+}
+
+// writeResponse writes the error response, leaving out the body for HEAD requests
+func (h *HandlerError) writeResponse(conn io.Writer, includeBody bool) {
 	var writer response.Writer
 	statusCode := h.StatusCode
 	message := h.Message
 	writer.WriteStatusLine(statusCode)
 	writer.WriteBody(message)
 	defaultHeaders := response.GetDefaultHeaders(len(writer.Body))
+	mergeHeaders(defaultHeaders, h.Headers)
 	writer.WriteHeaders(defaultHeaders)
 
 	conn.Write(writer.StatusLine)
 	conn.Write(writer.Headers)
-	conn.Write(writer.Body)
+	if includeBody {
+		conn.Write(writer.Body)
+	}
 }
 
-func (s *Server) handleNormalResponse(conn net.Conn, req *request.Request) {
+// isBodyAllowed reports whether the response to req may have a body, HEAD responses only carry
+// the headers the same GET request would get
+func isBodyAllowed(req *request.Request) bool {
+	return req.RequestLine.Method != "HEAD"
+}
+
+func (s *Server) handleNormalResponse(responseWriter *ResponseWriter, req *request.Request) response.StatusCode {
 	var writer response.Writer
 
-	buffer := bytes.NewBuffer([]byte{})
+	conn := responseWriter.conn
+	responseWriter.suppressBody = !isBodyAllowed(req)
+	responseWriter.negotiateEncoding = func(responseHeaders headers.Headers, length int64) string {
+		return s.negotiateCompression(req.Headers.Get("accept-encoding"), responseHeaders, length)
+	}
+
+	handlerError := s.Handler(responseWriter, req)
+	if responseWriter.hijacked {
+		s.Metrics.connectionHijacked()
+		return responseWriter.statusCode
+	}
+	if responseWriter.wroteHeader {
+		if handlerError != nil {
+			s.ErrorLogger.Error("handler failed after the response was started", "status", handlerError.StatusCode, "error", string(handlerError.Message))
+		}
+		if err := responseWriter.finish(); err != nil {
+			s.ErrorLogger.Error("error finishing response", "error", err)
+		}
+		return responseWriter.statusCode
+	}
 
-	handlerError := s.Handler(buffer, req)
 	if handlerError != nil {
-		handlerError.Write(conn)
-		return
+		handlerError.writeResponse(conn, isBodyAllowed(req))
+		return handlerError.StatusCode
 	}
-	body := buffer.Bytes()
+	body := responseWriter.buffer.Bytes()
 
 	writer.WriteStatusLine(response.OK)
 
-	var responseHeaders headers.Headers
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/video") {
-		writer.Body = body
-		responseHeaders = response.GetVideoHeaders(len(body))
-	} else {
-		bodyLength, err := writer.WriteBody(body)
+	bodyLength, err := writer.WriteBody(body)
+	if err != nil {
+		s.ErrorLogger.Error("error writing response body", "error", err)
+		return response.INTERNAL_SERVER_ERROR
+	}
+	responseHeaders := response.GetDefaultHeaders(bodyLength)
+	mergeHeaders(responseHeaders, responseWriter.header)
+
+	if s.ETags {
+		etag := response.StrongETag(writer.Body)
+		mergeHeaders(responseHeaders, headers.Headers{"etag": etag})
+
+		switch response.EvaluatePreconditions(req.Headers, req.RequestLine.Method, etag, time.Time{}) {
+		case response.NOT_MODIFIED:
+			deleteHeader(responseHeaders, "content-length")
+			writer.WriteStatusLine(response.NOT_MODIFIED)
+			writer.WriteHeaders(responseHeaders)
+			conn.Write(writer.StatusLine)
+			conn.Write(writer.Headers)
+			return response.NOT_MODIFIED
+		case response.PRECONDITION_FAILED:
+			herr := preconditionFailedError()
+			herr.writeResponse(conn, isBodyAllowed(req))
+			return herr.StatusCode
+		}
+	}
+	if encoding := s.negotiateCompression(req.Headers.Get("accept-encoding"), responseHeaders, int64(len(writer.Body))); encoding != "" {
+		compressed, err := compressBody(encoding, writer.Body)
 		if err != nil {
-			return
+			s.ErrorLogger.Error("error compressing response body", "error", err)
+		} else {
+			writer.Body = compressed
+			markCompressed(responseHeaders, encoding)
+			mergeHeaders(responseHeaders, headers.Headers{"content-length": fmt.Sprintf("%d", len(compressed))})
 		}
-		responseHeaders = response.GetDefaultHeaders(bodyLength)
 	}
 	writer.WriteHeaders(responseHeaders)
 
 	conn.Write(writer.StatusLine)
 	conn.Write(writer.Headers)
-	conn.Write(writer.Body)
-}
-
-func (s *Server) handleChunkedResponse(conn net.Conn, req *request.Request) {
-	var writer response.Writer
-
-	writer.WriteStatusLine(response.OK)
-	chunkedHeaders := response.GetChunkedHeaders()
-	writer.WriteHeaders(chunkedHeaders)
-
-	buffer := bytes.NewBuffer([]byte{})
-	go s.Handler(buffer, req)
-
-	for {
-		data := make([]byte, 1024)
-		readBytes, err := buffer.Read(data)
-		if err != nil {
-			continue
-		}
-		dataRead := data[:readBytes]
-		if bytes.Equal(dataRead, []byte("\r\n")) {
-			writer.WriteChunkedBodyDone()
-			break
-		}
-		writer.WriteChunkedBody(data[:readBytes])
+	if isBodyAllowed(req) {
+		conn.Write(writer.Body)
 	}
-	conn.Write(writer.Body)
-
-	trailers := headers.Headers{}
-	trailers["X-Content-SHA256"] = fmt.Sprintf("%v", sha256.Sum256(writer.Body))
-	trailers["X-Content-Length"] = fmt.Sprintf("%v", len(writer.Body))
 
-	writer.WriteTrailers(trailers)
-	conn.Write(writer.Trailers)
+	return response.OK
 }
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var (
+	ERROR_NO_CERTIFICATES = fmt.Errorf("error: at least one certificate is required")
+)
+
+type CertificateFiles struct {
+	CertFile string
+	KeyFile  string
+}
+
+// CertificateStore holds the certificates served over TLS. It picks one per connection using SNI
+// and can reload them from disk without restarting the server.
+type CertificateStore struct {
+	files        []CertificateFiles
+	mu           sync.RWMutex
+	certificates []tls.Certificate
+}
+
+func NewCertificateStore(files ...CertificateFiles) (*CertificateStore, error) {
+	if len(files) == 0 {
+		return nil, ERROR_NO_CERTIFICATES
+	}
+
+	store := &CertificateStore{
+		files: files,
+	}
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Reload reads every certificate again. When any of them fails to load the current ones are kept.
+func (c *CertificateStore) Reload() error {
+	certificates := make([]tls.Certificate, 0, len(c.files))
+	for _, files := range c.files {
+		certificate, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			return fmt.Errorf("error: loading certificate %s: %w", files.CertFile, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	c.mu.Lock()
+	c.certificates = certificates
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for i := range c.certificates {
+		if hello.SupportsCertificate(&c.certificates[i]) == nil {
+			return &c.certificates[i], nil
+		}
+	}
+
+	return &c.certificates[0], nil
+}
+
+func (c *CertificateStore) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.GetCertificate,
+	}
+}
+
+// WithCertificateReload reloads store whenever the process receives SIGHUP
+func WithCertificateReload(store *CertificateStore) Option {
+	return func(s *Server) {
+		signals := make(chan os.Signal, 1)
+		done := make(chan struct{})
+		signal.Notify(signals, syscall.SIGHUP)
+
+		go func() {
+			for {
+				select {
+				case <-signals:
+					if err := store.Reload(); err != nil {
+						s.ErrorLogger.Error("error reloading certificates", "error", err)
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		s.onClose = append(s.onClose, func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+// ServeTLS is like Serve but terminates TLS using the certificate and key files, reloading them on SIGHUP
+func ServeTLS(port int, certFile, keyFile string, handler Handler, options ...Option) (*Server, error) {
+	store, err := NewCertificateStore(CertificateFiles{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		return nil, err
+	}
+
+	return ServeTLSConfig(port, store.Config(), handler, append(options, WithCertificateReload(store))...)
+}
+
+func ServeTLSConfig(port int, config *tls.Config, handler Handler, options ...Option) (*Server, error) {
+	listener, err := Listen(fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+
+	return ServeListener(tls.NewListener(listener, config), handler, options...)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"httpfromtcp/internal/request"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSelfSignedCertificate generates a certificate for name and writes it with its key into dir
+func writeSelfSignedCertificate(t *testing.T, dir, name string, serial int64) CertificateFiles {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	files := CertificateFiles{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	require.NoError(t, os.WriteFile(files.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(files.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+
+	return files
+}
+
+func dialTLS(t *testing.T, addr net.Addr, serverName string) (*x509.Certificate, string) {
+	conn, err := tls.Dial("tcp", addr.String(), &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: " + serverName + "\r\n\r\n"))
+	require.NoError(t, err)
+	responseBytes, err := io.ReadAll(conn)
+	require.NoError(t, err)
+
+	return conn.ConnectionState().PeerCertificates[0], string(responseBytes)
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	filesA := writeSelfSignedCertificate(t, dir, "a.test", 1)
+	filesB := writeSelfSignedCertificate(t, dir, "b.test", 2)
+
+	store, err := NewCertificateStore(filesA, filesB)
+	require.NoError(t, err)
+
+	serverNames := make(chan string, 3)
+	srv, err := ServeTLSConfig(0, store.Config(), func(w io.Writer, req *request.Request) *HandlerError {
+		serverNames <- req.TLS.ServerName
+		w.Write([]byte("secure"))
+		return nil
+	})
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Test: SNI picks the matching certificate
+	certificate, body := dialTLS(t, srv.Listener.Addr(), "b.test")
+	assert.Equal(t, "b.test", certificate.Subject.CommonName)
+	assert.Contains(t, body, "secure")
+	assert.Equal(t, "b.test", <-serverNames)
+
+	certificate, _ = dialTLS(t, srv.Listener.Addr(), "a.test")
+	assert.Equal(t, "a.test", certificate.Subject.CommonName)
+	assert.Equal(t, "a.test", <-serverNames)
+
+	// Test: Reload picks up certificates replaced on disk
+	writeSelfSignedCertificate(t, dir, "a.test", 3)
+	require.NoError(t, store.Reload())
+	certificate, _ = dialTLS(t, srv.Listener.Addr(), "a.test")
+	assert.Equal(t, int64(3), certificate.SerialNumber.Int64())
+	<-serverNames
+
+	// Test: Failed reload keeps the current certificates
+	require.NoError(t, os.WriteFile(filesB.CertFile, []byte("garbage"), 0o600))
+	require.Error(t, store.Reload())
+}
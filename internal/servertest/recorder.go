@@ -0,0 +1,91 @@
+package servertest
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+)
+
+// Recorder holds a response as the client received it
+type Recorder struct {
+	StatusCode response.StatusCode
+	Reason     string
+	Headers    headers.Headers
+	// Body has the transfer framing removed, a content coding is left as it was sent
+	Body     []byte
+	Trailers headers.Headers
+	// Informational are the status codes of the interim responses sent before the final one
+	Informational []response.StatusCode
+	// Raw is the response exactly as it was written
+	Raw []byte
+}
+
+// Record runs handler for req without any connection, through the same response path as a
+// server built with options, and records what it wrote. The server is closed afterwards.
+func Record(handler server.Handler, req *request.Request, options ...server.Option) (*Recorder, error) {
+	buffer := &bytes.Buffer{}
+	srv := server.New(handler, options...)
+	defer srv.Close()
+	srv.ServeRequest(buffer, req)
+
+	return ParseResponse(buffer.Bytes(), req.RequestLine.Method)
+}
+
+// NewRequest builds a parsed request for Record, with a Host header and a Content-Length for body
+func NewRequest(method, target string, body []byte) *request.Request {
+	requestHeaders := headers.Headers{"host": "servertest"}
+	if len(body) > 0 {
+		requestHeaders.Set("content-length", strconv.Itoa(len(body)))
+	}
+	if body == nil {
+		body = []byte{}
+	}
+
+	return &request.Request{
+		RequestLine: request.RequestLine{Method: method, RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     requestHeaders,
+		Body:        body,
+		Trailers:    headers.Headers{},
+		State:       request.REQUEST_STATE_DONE,
+	}
+}
+
+// ParseRequest parses raw into a request for Record
+func ParseRequest(raw string) (*request.Request, error) {
+	return request.RequestFromReader(strings.NewReader(raw))
+}
+
+// ParseResponse records the raw response to a method request, reading its body to the end
+func ParseResponse(raw []byte, method string) (*Recorder, error) {
+	reader := bufio.NewReader(bytes.NewReader(raw))
+	recorder := &Recorder{Raw: raw}
+	for {
+		parsed, err := response.ResponseFromReader(reader, method)
+		if err != nil {
+			return nil, err
+		}
+		if parsed.Informational() {
+			recorder.Informational = append(recorder.Informational, parsed.StatusCode)
+			continue
+		}
+
+		body, err := io.ReadAll(parsed.Body)
+		if err != nil {
+			return nil, err
+		}
+		recorder.StatusCode = parsed.StatusCode
+		recorder.Reason = parsed.Reason
+		recorder.Headers = parsed.Headers
+		recorder.Body = body
+		recorder.Trailers = parsed.Trailers
+
+		return recorder, nil
+	}
+}
@@ -0,0 +1,148 @@
+package servertest
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"httpfromtcp/internal/server"
+)
+
+const (
+	DEFAULT_TIMEOUT = 5 * time.Second
+)
+
+var (
+	ERROR_NO_REQUEST_LINE = fmt.Errorf("error: raw request has no request line")
+)
+
+// Server is a server.Server whose connections are made with Dial
+type Server struct {
+	*server.Server
+	// Timeout bounds every exchange of Send and SendRaw, a handler that never finishes fails the test instead of hanging it
+	Timeout time.Duration
+
+	pipe *pipeListener
+}
+
+// NewServer serves handler on an in-memory listener, the connections are net.Pipe ends
+func NewServer(handler server.Handler, options ...server.Option) *Server {
+	pipe := &pipeListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+	srv, _ := server.ServeListener(pipe, handler, options...)
+
+	return &Server{Server: srv, Timeout: DEFAULT_TIMEOUT, pipe: pipe}
+}
+
+// NewTCPServer serves handler on an ephemeral port of the loopback interface, for tests that need real sockets
+func NewTCPServer(handler server.Handler, options ...server.Option) (*Server, error) {
+	srv, err := server.ServeAddress("127.0.0.1:0", handler, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{Server: srv, Timeout: DEFAULT_TIMEOUT}, nil
+}
+
+// URL returns the base URL of a TCP server
+func (s *Server) URL() string {
+	return "http://" + s.Addr().String()
+}
+
+// Dial opens a connection to the server
+func (s *Server) Dial() (net.Conn, error) {
+	if s.pipe != nil {
+		return s.pipe.dial()
+	}
+
+	return net.Dial("tcp", s.Addr().String())
+}
+
+// SendRaw writes raw to a new connection and returns everything the server sent until it closed the connection
+func (s *Server) SendRaw(raw string) (string, error) {
+	conn, err := s.Dial()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if s.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.Timeout))
+	}
+
+	// the server may answer before reading everything, e.g. rejecting a body, so the write can
+	// not block the read on a net.Pipe
+	written := make(chan error, 1)
+	go func() {
+		_, err := io.WriteString(conn, raw)
+		written <- err
+	}()
+
+	out, err := io.ReadAll(conn)
+	if err != nil {
+		return string(out), err
+	}
+	conn.Close()
+	if err := <-written; err != nil && len(out) == 0 {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// Send writes raw to a new connection and records the response, its method decides whether a
+// body follows the response head
+func (s *Server) Send(raw string) (*Recorder, error) {
+	method, _, ok := strings.Cut(raw, " ")
+	if !ok {
+		return nil, ERROR_NO_REQUEST_LINE
+	}
+
+	out, err := s.SendRaw(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseResponse([]byte(out), method)
+}
+
+// pipeListener hands out in-memory connections created by dial
+type pipeListener struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (p *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-p.conns:
+		return conn, nil
+	case <-p.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (p *pipeListener) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	return nil
+}
+
+func (p *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "servertest", Net: "pipe"}
+}
+
+func (p *pipeListener) dial() (net.Conn, error) {
+	clientConn, serverConn := net.Pipe()
+	select {
+	case p.conns <- serverConn:
+		return clientConn, nil
+	case <-p.closed:
+		clientConn.Close()
+		serverConn.Close()
+		return nil, net.ErrClosed
+	}
+}
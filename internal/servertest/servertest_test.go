@@ -0,0 +1,217 @@
+package servertest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"testing"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoHandler(w io.Writer, req *request.Request) *server.HandlerError {
+	if req.RequestLine.RequestTarget == "/fail" {
+		return &server.HandlerError{StatusCode: response.BAD_REQUEST, Message: []byte("failed")}
+	}
+	if herr := server.BodyError(req.ReadBody()); herr != nil {
+		return herr
+	}
+	w.Write([]byte(req.RequestLine.Method + " " + string(req.Body)))
+	return nil
+}
+
+func streamHandler(w io.Writer, req *request.Request) *server.HandlerError {
+	responseWriter := w.(*server.ResponseWriter)
+	responseWriter.WriteInformational(response.EARLY_HINTS, headers.Headers{"link": "</style.css>; rel=preload"})
+	responseWriter.Header().Set("trailer", "X-Count")
+	responseWriter.WriteHeader(response.CREATED)
+	responseWriter.Write([]byte("one,"))
+	responseWriter.Write([]byte("two"))
+	responseWriter.Trailer().Set("x-count", "2")
+	return nil
+}
+
+func jsonHandler(w io.Writer, req *request.Request) *server.HandlerError {
+	var decoded struct {
+		Name string `json:"name"`
+	}
+	if herr := server.BodyError(req.DecodeJSON(&decoded, request.JSONOptions{DisallowUnknownFields: true, MaxSize: 32})); herr != nil {
+		return herr
+	}
+	w.Write([]byte("hello " + decoded.Name))
+	return nil
+}
+
+func TestRecord(t *testing.T) {
+	// Test: Buffered response
+	recorder, err := Record(echoHandler, NewRequest("POST", "/echo", []byte("hello")))
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(response.OK), recorder.StatusCode)
+	assert.Equal(t, "OK", recorder.Reason)
+	assert.Contains(t, string(recorder.Body), "<p>POST hello</p>")
+	assert.Equal(t, strconv.Itoa(len(recorder.Body)), recorder.Headers.Get("content-length"))
+	assert.True(t, strings.HasPrefix(string(recorder.Raw), "HTTP/1.1 200 OK\r\n"))
+
+	// Test: Handler errors
+	recorder, err = Record(echoHandler, NewRequest("GET", "/fail", nil))
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(response.BAD_REQUEST), recorder.StatusCode)
+	assert.Contains(t, string(recorder.Body), "failed")
+
+	// Test: Streamed response with trailers
+	recorder, err = Record(streamHandler, NewRequest("GET", "/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, []response.StatusCode{response.EARLY_HINTS}, recorder.Informational)
+	assert.Equal(t, response.StatusCode(response.CREATED), recorder.StatusCode)
+	assert.Equal(t, "chunked", recorder.Headers.Get("transfer-encoding"))
+	assert.Equal(t, "one,two", string(recorder.Body))
+	assert.Equal(t, "2", recorder.Trailers.Get("x-count"))
+
+	// Test: Decoding errors are mapped to status codes
+	for body, statusCode := range map[string]response.StatusCode{
+		`{"name": "gopher"}`:                          response.OK,
+		`{"name": "gopher", "age": 15}`:               response.BAD_REQUEST,
+		`{"name": "` + strings.Repeat("a", 32) + `"}`: response.CONTENT_TOO_LARGE,
+	} {
+		req := NewRequest("POST", "/json", []byte(body))
+		req.Headers.Set("content-type", "application/json")
+		recorder, err = Record(jsonHandler, req)
+		require.NoError(t, err)
+		assert.Equal(t, statusCode, recorder.StatusCode, body)
+	}
+	recorder, err = Record(jsonHandler, NewRequest("POST", "/json", []byte(`{"name": "gopher"}`)))
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(response.UNSUPPORTED_MEDIA_TYPE), recorder.StatusCode)
+
+	// Test: Server options apply and HEAD responses have no body
+	req, err := ParseRequest("HEAD / HTTP/1.1\r\nHost: servertest\r\n\r\n")
+	require.NoError(t, err)
+	recorder, err = Record(echoHandler, req, server.WithETags())
+	require.NoError(t, err)
+	assert.NotEmpty(t, recorder.Headers.Get("etag"))
+	assert.Empty(t, recorder.Body)
+
+	// Test: The server is closed once the response was recorded
+	var recorded *server.Server
+	_, err = Record(echoHandler, NewRequest("GET", "/", nil), func(s *server.Server) { recorded = s })
+	require.NoError(t, err)
+	assert.True(t, recorded.IsTerminated.Load())
+
+	// Test: Request bodies are decoded like the server decodes them
+	encoded := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(encoded)
+	gzipWriter.Write([]byte("hello"))
+	require.NoError(t, gzipWriter.Close())
+	req = NewRequest("POST", "/echo", encoded.Bytes())
+	req.Headers.Set("content-encoding", "gzip")
+	recorder, err = Record(echoHandler, req, server.WithRequestDecoding(1024))
+	require.NoError(t, err)
+	assert.Contains(t, string(recorder.Body), "<p>POST hello</p>")
+
+	req, err = ParseRequest(fmt.Sprintf("POST /echo HTTP/1.1\r\nHost: servertest\r\nContent-Encoding: gzip\r\nContent-Length: %d\r\n\r\n%s", encoded.Len(), encoded.String()))
+	require.NoError(t, err)
+	recorder, err = Record(echoHandler, req, server.WithRequestDecoding(1024))
+	require.NoError(t, err)
+	assert.Contains(t, string(recorder.Body), "<p>POST hello</p>")
+}
+
+func TestServer(t *testing.T) {
+	inMemory := NewServer(echoHandler)
+	defer inMemory.Close()
+	tcp, err := NewTCPServer(streamHandler)
+	require.NoError(t, err)
+	defer tcp.Close()
+	assert.True(t, strings.HasPrefix(tcp.URL(), "http://127.0.0.1:"))
+
+	// Test: Raw exchange on an in-memory connection
+	raw, err := inMemory.SendRaw("GET / HTTP/1.1\r\nHost: servertest\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, "HTTP/1.1 200 OK\r\n"), raw)
+	assert.Contains(t, raw, "<p>GET </p>")
+
+	// Test: Request bodies
+	recorder, err := inMemory.Send("PUT / HTTP/1.1\r\nHost: servertest\r\nContent-Length: 4\r\n\r\ndata")
+	require.NoError(t, err)
+	assert.Contains(t, string(recorder.Body), "<p>PUT data</p>")
+
+	// Test: Malformed requests
+	recorder, err = inMemory.Send("GET /\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(response.BAD_REQUEST), recorder.StatusCode)
+	recorder, err = inMemory.Send("POST / HTTP/1.1\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(response.BAD_REQUEST), recorder.StatusCode)
+	_, err = inMemory.Send("garbage")
+	assert.ErrorIs(t, err, ERROR_NO_REQUEST_LINE)
+
+	// Test: Exchange over TCP
+	recorder, err = tcp.Send("GET / HTTP/1.1\r\nHost: servertest\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, []response.StatusCode{response.EARLY_HINTS}, recorder.Informational)
+	assert.Equal(t, "one,two", string(recorder.Body))
+	assert.Equal(t, "2", recorder.Trailers.Get("x-count"))
+
+	// Test: Lenient servers normalise deviating requests and count them
+	metrics := server.NewMetrics()
+	lenient := NewServer(echoHandler, server.WithLeniency(request.Leniency{BareLF: true, LowercaseMethods: true}), server.WithMetrics(metrics, "/metrics"))
+	defer lenient.Close()
+	recorder, err = lenient.Send("put / HTTP/1.1\nHost: servertest\nContent-Length: 4\n\ndata")
+	require.NoError(t, err)
+	assert.Contains(t, string(recorder.Body), "<p>PUT data</p>")
+	recorder, err = lenient.Send("GET /metrics HTTP/1.1\r\nHost: servertest\r\n\r\n")
+	require.NoError(t, err)
+	assert.Contains(t, string(recorder.Body), "httpfromtcp_lenient_requests_total{deviation=\"lowercase-method\"} 1\n")
+	recorder, err = inMemory.Send("put / HTTP/1.1\r\nHost: servertest\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(response.BAD_REQUEST), recorder.StatusCode)
+
+	// Test: No connections once closed
+	inMemory.Close()
+	_, err = inMemory.Dial()
+	assert.Error(t, err)
+}
+
+func TestServerMultipartUpload(t *testing.T) {
+	handler := func(w io.Writer, req *request.Request) *server.HandlerError {
+		size := 0
+		values, err := req.ParseMultipartForm(request.MultipartLimits{MaxFileSize: 2 * request.DEFAULT_MAX_BODY_SIZE}, func(file *request.FilePart) error {
+			n, err := io.Copy(io.Discard, file)
+			size += int(n)
+			return err
+		})
+		if herr := server.BodyError(err); herr != nil {
+			return herr
+		}
+		fmt.Fprintf(w, "title=%s size=%d buffered=%d", values.Get("title"), size, len(req.Body))
+		return nil
+	}
+	srv, err := NewTCPServer(handler)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	require.NoError(t, writer.WriteField("title", "large"))
+	file, err := writer.CreateFormFile("upload", "large.bin")
+	require.NoError(t, err)
+	fileSize := request.DEFAULT_MAX_BODY_SIZE + 1024*1024
+	file.Write(bytes.Repeat([]byte("x"), fileSize))
+	require.NoError(t, writer.Close())
+
+	// Test: Multipart uploads larger than the body limit are streamed to the handler
+	recorder, err := srv.Send(fmt.Sprintf("POST /upload HTTP/1.1\r\nHost: servertest\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s",
+		writer.FormDataContentType(), body.Len(), body.String()))
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(response.OK), recorder.StatusCode)
+	assert.Contains(t, string(recorder.Body), fmt.Sprintf("title=large size=%d buffered=0", fileSize))
+}
@@ -0,0 +1,90 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+)
+
+// DEFLATE_RESPONSE accepts permessage-deflate without context takeover, every message is
+// compressed on its own so no compressor state outlives a message, see RFC 7692
+const DEFLATE_RESPONSE = "permessage-deflate; server_no_context_takeover; client_no_context_takeover"
+
+// deflateTail is removed from every compressed message and added back before inflating it
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+// acceptsDeflate reports whether one of the offered extensions is a permessage-deflate we
+// can honour, offers limiting our window with server_max_window_bits can not be
+func acceptsDeflate(extensions string) bool {
+	for _, offer := range strings.Split(extensions, ",") {
+		params := strings.Split(offer, ";")
+		if strings.TrimSpace(params[0]) != "permessage-deflate" {
+			continue
+		}
+
+		acceptable := true
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			switch name {
+			case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+			case "server_max_window_bits":
+				acceptable = strings.Trim(value, `"`) == "15"
+			default:
+				acceptable = false
+			}
+		}
+		if acceptable {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deflateWriter compresses one message, Write flushes so every fragment can be sent at once
+type deflateWriter struct {
+	buffer     bytes.Buffer
+	compressor *flate.Writer
+}
+
+func newDeflateWriter() *deflateWriter {
+	d := &deflateWriter{}
+	d.compressor, _ = flate.NewWriter(&d.buffer, flate.DefaultCompression)
+
+	return d
+}
+
+// compress returns the compressed bytes of p, last also drops the tail ending the message
+func (d *deflateWriter) compress(p []byte, last bool) ([]byte, error) {
+	if _, err := d.compressor.Write(p); err != nil {
+		return nil, err
+	}
+	if err := d.compressor.Flush(); err != nil {
+		return nil, err
+	}
+
+	compressed := bytes.Clone(d.buffer.Bytes())
+	d.buffer.Reset()
+	if last {
+		compressed = bytes.TrimSuffix(compressed, deflateTail)
+	}
+
+	return compressed, nil
+}
+
+// inflate decompresses a message, failing once it gets larger than maxSize
+func inflate(payload []byte, maxSize int64) ([]byte, error) {
+	reader := flate.NewReader(io.MultiReader(bytes.NewReader(payload), bytes.NewReader(deflateTail)))
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, ERROR_MESSAGE_TOO_LARGE
+	}
+
+	return data, nil
+}
@@ -0,0 +1,445 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	CONTINUATION_FRAME = 0x0
+	TEXT_MESSAGE       = 0x1
+	BINARY_MESSAGE     = 0x2
+	CLOSE_MESSAGE      = 0x8
+	PING_MESSAGE       = 0x9
+	PONG_MESSAGE       = 0xa
+
+	CLOSE_NORMAL           = 1000
+	CLOSE_GOING_AWAY       = 1001
+	CLOSE_PROTOCOL_ERROR   = 1002
+	CLOSE_UNSUPPORTED_DATA = 1003
+	CLOSE_NO_STATUS        = 1005
+	CLOSE_INVALID_PAYLOAD  = 1007
+	CLOSE_POLICY_VIOLATION = 1008
+	CLOSE_MESSAGE_TOO_BIG  = 1009
+	CLOSE_INTERNAL_ERROR   = 1011
+
+	finBit  = 0x80
+	rsv1Bit = 0x40
+	rsv2Bit = 0x20
+	rsv3Bit = 0x10
+	maskBit = 0x80
+
+	maxControlPayload = 125
+	closeWriteTimeout = 5 * time.Second
+)
+
+var (
+	ERROR_PROTOCOL_VIOLATION = fmt.Errorf("error: websocket protocol violation")
+	ERROR_MESSAGE_TOO_LARGE  = fmt.Errorf("error: websocket message is too large")
+	ERROR_INVALID_PAYLOAD    = fmt.Errorf("error: websocket message payload is invalid")
+	ERROR_CONNECTION_CLOSED  = fmt.Errorf("error: websocket close frame was already sent")
+	ERROR_INVALID_MESSAGE    = fmt.Errorf("error: only text and binary messages can be written")
+)
+
+// CloseError is returned by ReadMessage once the peer sent a close frame
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed with %d %s", e.Code, e.Reason)
+}
+
+// Conn is a websocket connection. One goroutine may read while others write, writes are serialised.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// client connections mask the frames they send and expect unmasked frames back
+	client      bool
+	compression bool
+	subprotocol string
+	// MaxMessageSize limits received messages after decompression
+	MaxMessageSize int64
+
+	writeMutex sync.Mutex
+	closeSent  bool
+}
+
+type frame struct {
+	fin     bool
+	rsv1    bool
+	opcode  byte
+	payload []byte
+}
+
+func newConn(conn net.Conn, client, compression bool) *Conn {
+	return &Conn{
+		conn:           conn,
+		reader:         bufio.NewReader(conn),
+		client:         client,
+		compression:    compression,
+		MaxMessageSize: DEFAULT_MAX_MESSAGE_SIZE,
+	}
+}
+
+// Subprotocol returns the subprotocol agreed on during the handshake
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// NetConn returns the underlying connection, e.g. to set deadlines
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+// ReadMessage returns the next text or binary message, reassembling fragments. Pings are
+// answered on the way. Once the peer closes, the close is acknowledged and a *CloseError returned.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	messageType := 0
+	compressed := false
+	var message []byte
+
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case PING_MESSAGE:
+			if err := c.writeFrame(true, false, PONG_MESSAGE, f.payload); err != nil && err != ERROR_CONNECTION_CLOSED {
+				return 0, nil, err
+			}
+			continue
+		case PONG_MESSAGE:
+			continue
+		case CLOSE_MESSAGE:
+			return 0, nil, c.handleClose(f.payload)
+		case TEXT_MESSAGE, BINARY_MESSAGE:
+			if messageType != 0 {
+				return 0, nil, c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL_VIOLATION, "new message before the last fragment")
+			}
+			messageType = int(f.opcode)
+			compressed = f.rsv1
+		case CONTINUATION_FRAME:
+			if messageType == 0 {
+				return 0, nil, c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL_VIOLATION, "continuation without a message")
+			}
+			if f.rsv1 {
+				return 0, nil, c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL_VIOLATION, "RSV1 set on a continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL_VIOLATION, fmt.Sprintf("unknown opcode %d", f.opcode))
+		}
+
+		message = append(message, f.payload...)
+		if int64(len(message)) > c.MaxMessageSize {
+			return 0, nil, c.fail(CLOSE_MESSAGE_TOO_BIG, ERROR_MESSAGE_TOO_LARGE, "message too big")
+		}
+		if !f.fin {
+			continue
+		}
+
+		if compressed {
+			message, err = inflate(message, c.MaxMessageSize)
+			if err == ERROR_MESSAGE_TOO_LARGE {
+				return 0, nil, c.fail(CLOSE_MESSAGE_TOO_BIG, ERROR_MESSAGE_TOO_LARGE, "message too big")
+			}
+			if err != nil {
+				return 0, nil, c.fail(CLOSE_INVALID_PAYLOAD, ERROR_INVALID_PAYLOAD, "invalid compressed data")
+			}
+		}
+		if messageType == TEXT_MESSAGE && !utf8.Valid(message) {
+			return 0, nil, c.fail(CLOSE_INVALID_PAYLOAD, ERROR_INVALID_PAYLOAD, "text message is not valid UTF-8")
+		}
+
+		return messageType, message, nil
+	}
+}
+
+// WriteMessage sends data as a single text or binary frame, compressed when negotiated
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	writer, err := c.newMessageWriter(messageType)
+	if err != nil {
+		return err
+	}
+	writer.closed = true
+
+	return writer.writeFragment(data, true)
+}
+
+// NextWriter starts a fragmented message, every Write sends one frame and Close sends the last
+// one. Other messages must not be written until Close returned.
+func (c *Conn) NextWriter(messageType int) (io.WriteCloser, error) {
+	return c.newMessageWriter(messageType)
+}
+
+func (c *Conn) newMessageWriter(messageType int) (*messageWriter, error) {
+	if messageType != TEXT_MESSAGE && messageType != BINARY_MESSAGE {
+		return nil, ERROR_INVALID_MESSAGE
+	}
+
+	writer := &messageWriter{conn: c, opcode: byte(messageType)}
+	if c.compression {
+		writer.deflate = newDeflateWriter()
+	}
+
+	return writer, nil
+}
+
+// WritePing sends a ping, the peer answers with a pong carrying the same data
+func (c *Conn) WritePing(data []byte) error {
+	if len(data) > maxControlPayload {
+		return ERROR_MESSAGE_TOO_LARGE
+	}
+
+	return c.writeFrame(true, false, PING_MESSAGE, data)
+}
+
+// WriteClose starts the close handshake, ReadMessage returns a *CloseError once the peer answered
+func (c *Conn) WriteClose(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		return ERROR_MESSAGE_TOO_LARGE
+	}
+
+	return c.writeFrame(true, false, CLOSE_MESSAGE, payload)
+}
+
+// Close closes the underlying connection without a close handshake
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// handleClose validates the close frame of the peer and acknowledges it with the same code
+func (c *Conn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CLOSE_NO_STATUS}
+
+	switch {
+	case len(payload) == 1:
+		return c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL_VIOLATION, "close frame payload of 1 byte")
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+		if !validCloseCode(closeErr.Code) {
+			return c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL_VIOLATION, "invalid close code")
+		}
+		if !utf8.ValidString(closeErr.Reason) {
+			return c.fail(CLOSE_INVALID_PAYLOAD, ERROR_INVALID_PAYLOAD, "close reason is not valid UTF-8")
+		}
+	}
+
+	var err error
+	if closeErr.Code == CLOSE_NO_STATUS {
+		err = c.writeFrame(true, false, CLOSE_MESSAGE, nil)
+	} else {
+		err = c.WriteClose(closeErr.Code, "")
+	}
+	if err != nil && err != ERROR_CONNECTION_CLOSED {
+		return err
+	}
+
+	return closeErr
+}
+
+// validCloseCode reports whether code may be sent in a close frame, see RFC 6455 section 7.4
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	default:
+		return false
+	}
+}
+
+// fail sends a close frame with code and returns err, the connection is unusable afterwards
+func (c *Conn) fail(code int, err error, reason string) error {
+	c.conn.SetWriteDeadline(time.Now().Add(closeWriteTimeout))
+	c.WriteClose(code, reason)
+
+	return fmt.Errorf("%w: %s", err, reason)
+}
+
+func (c *Conn) readFrame() (*frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return nil, err
+	}
+
+	f := &frame{
+		fin:    header[0]&finBit != 0,
+		rsv1:   header[0]&rsv1Bit != 0,
+		opcode: header[0] & 0x0f,
+	}
+	masked := header[1]&maskBit != 0
+	length := uint64(header[1] & 0x7f)
+
+	if header[0]&(rsv2Bit|rsv3Bit) != 0 || (f.rsv1 && !c.compression) {
+		return nil, c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL_VIOLATION, "reserved bits set")
+	}
+	if masked == c.client {
+		return nil, c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL_VIOLATION, "wrong masking")
+	}
+	if f.opcode >= CLOSE_MESSAGE {
+		if !f.fin || length > maxControlPayload {
+			return nil, c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL_VIOLATION, "fragmented or oversized control frame")
+		}
+		if f.rsv1 {
+			return nil, c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL_VIOLATION, "RSV1 set on a control frame")
+		}
+	}
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+		if length>>63 != 0 {
+			return nil, c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL_VIOLATION, "invalid payload length")
+		}
+	}
+	if length > uint64(c.MaxMessageSize) {
+		return nil, c.fail(CLOSE_MESSAGE_TOO_BIG, ERROR_MESSAGE_TOO_LARGE, "message too big")
+	}
+
+	var maskKey [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, maskKey[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, f.payload); err != nil {
+		return nil, err
+	}
+	if masked {
+		maskBytes(maskKey, f.payload)
+	}
+
+	return f, nil
+}
+
+func (c *Conn) writeFrame(fin, rsv1 bool, opcode byte, payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.closeSent {
+		return ERROR_CONNECTION_CLOSED
+	}
+	if opcode == CLOSE_MESSAGE {
+		c.closeSent = true
+	}
+
+	first := opcode
+	if fin {
+		first |= finBit
+	}
+	if rsv1 {
+		first |= rsv1Bit
+	}
+	frameBytes := []byte{first, 0}
+
+	length := len(payload)
+	switch {
+	case length <= maxControlPayload:
+		frameBytes[1] = byte(length)
+	case length <= 0xffff:
+		frameBytes[1] = 126
+		frameBytes = binary.BigEndian.AppendUint16(frameBytes, uint16(length))
+	default:
+		frameBytes[1] = 127
+		frameBytes = binary.BigEndian.AppendUint64(frameBytes, uint64(length))
+	}
+
+	if c.client {
+		var maskKey [4]byte
+		if _, err := rand.Read(maskKey[:]); err != nil {
+			return err
+		}
+		frameBytes[1] |= maskBit
+		frameBytes = append(frameBytes, maskKey[:]...)
+		start := len(frameBytes)
+		frameBytes = append(frameBytes, payload...)
+		maskBytes(maskKey, frameBytes[start:])
+	} else {
+		frameBytes = append(frameBytes, payload...)
+	}
+
+	_, err := c.conn.Write(frameBytes)
+	return err
+}
+
+func maskBytes(key [4]byte, payload []byte) {
+	for i := range payload {
+		payload[i] ^= key[i%4]
+	}
+}
+
+// messageWriter sends a message frame by frame, see Conn.NextWriter
+type messageWriter struct {
+	conn    *Conn
+	opcode  byte
+	deflate *deflateWriter
+	closed  bool
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ERROR_CONNECTION_CLOSED
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := w.writeFragment(p, false); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (w *messageWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	return w.writeFragment(nil, true)
+}
+
+// writeFragment sends p as the next frame, only the first frame carries the opcode and RSV1
+func (w *messageWriter) writeFragment(p []byte, fin bool) error {
+	payload := p
+	if w.deflate != nil {
+		compressed, err := w.deflate.compress(p, fin)
+		if err != nil {
+			return err
+		}
+		payload = compressed
+	}
+
+	opcode := w.opcode
+	first := opcode != CONTINUATION_FRAME
+	w.opcode = CONTINUATION_FRAME
+
+	return w.conn.writeFrame(fin, first && w.deflate != nil, opcode, payload)
+}
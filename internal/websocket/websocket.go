@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net/url"
+	"strings"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+)
+
+const (
+	WEBSOCKET_VERSION = "13"
+	// WEBSOCKET_GUID is appended to Sec-WebSocket-Key to compute Sec-WebSocket-Accept, see RFC 6455 section 1.3
+	WEBSOCKET_GUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	DEFAULT_MAX_MESSAGE_SIZE = 1 << 20
+)
+
+// Upgrader turns requests into websocket connections
+type Upgrader struct {
+	// Subprotocols lists the supported subprotocols by preference, the first one the client offers is picked
+	Subprotocols []string
+	// EnableCompression accepts permessage-deflate when the client offers it
+	EnableCompression bool
+	// MaxMessageSize limits received messages after decompression, DEFAULT_MAX_MESSAGE_SIZE when 0
+	MaxMessageSize int64
+	// CheckOrigin rejects cross origin requests with 403, by default the Origin host has to match Host
+	CheckOrigin func(req *request.Request) bool
+}
+
+// Upgrade validates the handshake, answers it with 101 Switching Protocols and hijacks the
+// connection. When it returns an error response the handler should return it as is.
+func (u *Upgrader) Upgrade(w io.Writer, req *request.Request) (*Conn, *server.HandlerError) {
+	if req.RequestLine.Method != "GET" {
+		return nil, handshakeError(response.METHOD_NOT_ALLOWED, "websocket handshakes use GET")
+	}
+	if !req.Headers.HasToken("connection", "upgrade") || !req.Headers.HasToken("upgrade", "websocket") {
+		return nil, handshakeError(response.BAD_REQUEST, "missing Connection: Upgrade and Upgrade: websocket")
+	}
+	if req.Headers.Get("sec-websocket-version") != WEBSOCKET_VERSION {
+		herr := handshakeError(response.UPGRADE_REQUIRED, "unsupported websocket version")
+		herr.Headers["sec-websocket-version"] = WEBSOCKET_VERSION
+		return nil, herr
+	}
+	key := req.Headers.Get("sec-websocket-key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, handshakeError(response.BAD_REQUEST, "invalid Sec-WebSocket-Key")
+	}
+
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(req) {
+		return nil, handshakeError(response.FORBIDDEN, "origin not allowed")
+	}
+
+	responseWriter, ok := w.(*server.ResponseWriter)
+	if !ok {
+		return nil, handshakeError(response.INTERNAL_SERVER_ERROR, "response writer can not be hijacked")
+	}
+
+	header := responseWriter.Header()
+	header.Set("upgrade", "websocket")
+	header.Set("connection", "Upgrade")
+	header.Set("sec-websocket-accept", AcceptKey(key))
+
+	subprotocol := u.selectSubprotocol(req.Headers.Get("sec-websocket-protocol"))
+	if subprotocol != "" {
+		header.Set("sec-websocket-protocol", subprotocol)
+	}
+	compression := u.EnableCompression && acceptsDeflate(req.Headers.Get("sec-websocket-extensions"))
+	if compression {
+		header.Set("sec-websocket-extensions", DEFLATE_RESPONSE)
+	}
+
+	if err := responseWriter.WriteHeader(response.SWITCHING_PROTOCOLS); err != nil {
+		return nil, handshakeError(response.INTERNAL_SERVER_ERROR, err.Error())
+	}
+	netConn, buffered, err := responseWriter.Hijack()
+	if err != nil {
+		return nil, handshakeError(response.INTERNAL_SERVER_ERROR, err.Error())
+	}
+
+	conn := newConn(netConn, false, compression)
+	if len(buffered) > 0 {
+		conn.reader = bufio.NewReader(io.MultiReader(bytes.NewReader(buffered), netConn))
+	}
+	conn.subprotocol = subprotocol
+	if u.MaxMessageSize > 0 {
+		conn.MaxMessageSize = u.MaxMessageSize
+	}
+
+	return conn, nil
+}
+
+// AcceptKey computes the Sec-WebSocket-Accept value answering key
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + WEBSOCKET_GUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (u *Upgrader) selectSubprotocol(offered string) string {
+	for _, supported := range u.Subprotocols {
+		for _, protocol := range strings.Split(offered, ",") {
+			if strings.TrimSpace(protocol) == supported {
+				return supported
+			}
+		}
+	}
+
+	return ""
+}
+
+func handshakeError(statusCode response.StatusCode, message string) *server.HandlerError {
+	return &server.HandlerError{
+		StatusCode: statusCode,
+		Message:    []byte(message),
+		Headers:    headers.Headers{},
+	}
+}
+
+// sameOrigin accepts requests without Origin, browsers always send it on cross origin handshakes
+func sameOrigin(req *request.Request) bool {
+	origin := req.Headers.Get("origin")
+	if origin == "" {
+		return true
+	}
+
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(originURL.Host, req.Headers.Get("host"))
+}
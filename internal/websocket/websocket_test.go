@@ -0,0 +1,219 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+func echoServer(t *testing.T, upgrader *Upgrader) *server.Server {
+	srv, err := server.ServeAddress("127.0.0.1:0", func(w io.Writer, req *request.Request) *server.HandlerError {
+		conn, herr := upgrader.Upgrade(w, req)
+		if herr != nil {
+			return herr
+		}
+		defer conn.Close()
+
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return nil
+			}
+			if err := conn.WriteMessage(messageType, data); err != nil {
+				return nil
+			}
+		}
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+
+	return srv
+}
+
+// dial sends a handshake and returns the client side of the connection with the response head
+func dial(t *testing.T, srv *server.Server, extraHeaders string) (*Conn, string) {
+	netConn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { netConn.Close() })
+
+	handshake := "GET /ws HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: " + testKey + "\r\n" + extraHeaders + "\r\n"
+	_, err = netConn.Write([]byte(handshake))
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(netConn)
+	head := ""
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		head += line
+		if line == "\r\n" {
+			break
+		}
+	}
+
+	conn := newConn(netConn, true, strings.Contains(head, "permessage-deflate"))
+	conn.reader = reader
+
+	return conn, head
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Test: Example of RFC 6455 section 1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", AcceptKey(testKey))
+}
+
+func TestUpgrade(t *testing.T) {
+	srv := echoServer(t, &Upgrader{Subprotocols: []string{"dashboard"}})
+
+	// Test: Handshake
+	conn, head := dial(t, srv, "Sec-WebSocket-Protocol: chat, dashboard\r\n")
+	assert.True(t, strings.HasPrefix(head, "HTTP/1.1 101 Switching Protocols\r\n"))
+	assert.Contains(t, head, "sec-websocket-accept:s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n")
+	assert.Contains(t, head, "sec-websocket-protocol:dashboard\r\n")
+	assert.NotContains(t, head, "sec-websocket-extensions")
+
+	// Test: Text and binary messages are echoed
+	require.NoError(t, conn.WriteMessage(TEXT_MESSAGE, []byte("hello")))
+	messageType, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, TEXT_MESSAGE, messageType)
+	assert.Equal(t, "hello", string(data))
+
+	large := bytes.Repeat([]byte{0, 1, 2, 3}, 20000)
+	require.NoError(t, conn.WriteMessage(BINARY_MESSAGE, large))
+	messageType, data, err = conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, BINARY_MESSAGE, messageType)
+	assert.Equal(t, large, data)
+
+	// Test: Fragments are reassembled, pings in between are answered
+	writer, err := conn.NextWriter(TEXT_MESSAGE)
+	require.NoError(t, err)
+	writer.Write([]byte("frag"))
+	require.NoError(t, conn.WritePing([]byte("are you there")))
+	writer.Write([]byte("mented"))
+	require.NoError(t, writer.Close())
+	pong, err := conn.readFrame()
+	require.NoError(t, err)
+	assert.Equal(t, byte(PONG_MESSAGE), pong.opcode)
+	assert.Equal(t, "are you there", string(pong.payload))
+	_, data, err = conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "fragmented", string(data))
+
+	// Test: Close handshake
+	require.NoError(t, conn.WriteClose(CLOSE_NORMAL, "bye"))
+	_, _, err = conn.ReadMessage()
+	var closeErr *CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CLOSE_NORMAL, closeErr.Code)
+	assert.ErrorIs(t, conn.WriteMessage(TEXT_MESSAGE, []byte("late")), ERROR_CONNECTION_CLOSED)
+}
+
+func TestUpgradeCompression(t *testing.T) {
+	srv := echoServer(t, &Upgrader{EnableCompression: true})
+
+	// Test: permessage-deflate is negotiated and used in both directions
+	conn, head := dial(t, srv, "Sec-WebSocket-Extensions: permessage-deflate; client_max_window_bits\r\n")
+	assert.Contains(t, head, "sec-websocket-extensions:"+DEFLATE_RESPONSE+"\r\n")
+
+	message := strings.Repeat("compress me please ", 100)
+	require.NoError(t, conn.WriteMessage(TEXT_MESSAGE, []byte(message)))
+	f, err := conn.readFrame()
+	require.NoError(t, err)
+	assert.True(t, f.rsv1)
+	assert.Less(t, len(f.payload), len(message))
+	data, err := inflate(f.payload, DEFAULT_MAX_MESSAGE_SIZE)
+	require.NoError(t, err)
+	assert.Equal(t, message, string(data))
+
+	writer, err := conn.NextWriter(BINARY_MESSAGE)
+	require.NoError(t, err)
+	writer.Write([]byte("first "))
+	writer.Write([]byte("second"))
+	require.NoError(t, writer.Close())
+	_, data, err = conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "first second", string(data))
+
+	// Test: Offers limiting the server window are declined
+	_, head = dial(t, srv, "Sec-WebSocket-Extensions: permessage-deflate; server_max_window_bits=10\r\n")
+	assert.NotContains(t, head, "sec-websocket-extensions")
+}
+
+func TestUpgradeErrors(t *testing.T) {
+	srv := echoServer(t, &Upgrader{})
+
+	send := func(rawRequest string) string {
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte(rawRequest))
+		require.NoError(t, err)
+		out, err := io.ReadAll(conn)
+		require.NoError(t, err)
+
+		return string(out)
+	}
+
+	// Test: Plain requests are not upgraded
+	out := send("GET /ws HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 400 Bad Request\r\n")
+
+	// Test: Unsupported version
+	out = send("GET /ws HTTP/1.1\r\nHost: localhost\r\nConnection: keep-alive, Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 8\r\nSec-WebSocket-Key: " + testKey + "\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 426 Upgrade Required\r\n")
+	assert.Contains(t, out, "sec-websocket-version:13\r\n")
+
+	// Test: Invalid key
+	out = send("GET /ws HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: short\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 400 Bad Request\r\n")
+
+	// Test: Cross origin
+	out = send("GET /ws HTTP/1.1\r\nHost: localhost\r\nOrigin: https://evil.example\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: " + testKey + "\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 403 Forbidden\r\n")
+}
+
+func TestProtocolErrors(t *testing.T) {
+	srv := echoServer(t, &Upgrader{MaxMessageSize: 16})
+
+	cases := []struct {
+		name  string
+		frame []byte
+		code  int
+	}{
+		{"unmasked frame", []byte{0x81, 0x02, 'h', 'i'}, CLOSE_PROTOCOL_ERROR},
+		{"reserved bit", []byte{0xa1, 0x80, 0, 0, 0, 0}, CLOSE_PROTOCOL_ERROR},
+		{"unknown opcode", []byte{0x83, 0x80, 0, 0, 0, 0}, CLOSE_PROTOCOL_ERROR},
+		{"fragmented ping", []byte{0x09, 0x80, 0, 0, 0, 0}, CLOSE_PROTOCOL_ERROR},
+		{"continuation first", []byte{0x80, 0x80, 0, 0, 0, 0}, CLOSE_PROTOCOL_ERROR},
+		{"invalid utf-8", []byte{0x81, 0x82, 0, 0, 0, 0, 0xc3, 0x28}, CLOSE_INVALID_PAYLOAD},
+		{"too big", []byte{0x82, 0x91, 0, 0, 0, 0}, CLOSE_MESSAGE_TOO_BIG},
+	}
+
+	for _, c := range cases {
+		// Test: Protocol violations fail the connection with a close code
+		conn, _ := dial(t, srv, "")
+		_, err := conn.conn.Write(c.frame)
+		require.NoError(t, err, c.name)
+
+		var header [4]byte
+		_, err = io.ReadFull(conn.reader, header[:])
+		require.NoError(t, err, c.name)
+		assert.Equal(t, byte(0x88), header[0], c.name)
+		assert.Equal(t, c.code, int(header[2])<<8|int(header[3]), fmt.Sprintf("%s: close code", c.name))
+	}
+}